@@ -0,0 +1,163 @@
+// Uploads the NDJSON files written by the osl emergency file handler to OpenSearch.
+//
+//	osl-replay -host localhost -user admin -index logging /var/log/myapp/emergency
+//
+// Arguments are files, or directories of emergency files. The password is taken
+// from the OSL_PASSWORD environment variable when -pass is not specified.
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jimsnab/go-lane"
+	osl "github.com/jimsnab/go-lane-opensearch"
+)
+
+func main() {
+	protocol := flag.String("protocol", "https", "protocol of the OpenSearch server")
+	host := flag.String("host", "localhost", "OpenSearch server host name")
+	port := flag.Int("port", 9200, "OpenSearch server port")
+	addresses := flag.String("addresses", "", "comma-separated OpenSearch node URLs, in place of -protocol, -host and -port")
+	user := flag.String("user", "", "OpenSearch user name")
+	pass := flag.String("pass", "", "OpenSearch password (default $OSL_PASSWORD)")
+	index := flag.String("index", "", "base name of the index")
+	shardFormat := flag.String("shard-format", "", "Go time layout appended to the index name, e.g. 2006-01-02")
+	batchSize := flag.Int("batch", osl.OslDefaultMaxBufferSize, "number of messages per bulk request")
+	backoffLimit := flag.Duration("backoff-limit", time.Minute, "how long to retry a failed batch")
+	insecure := flag.Bool("insecure", false, "skip verification of the server certificate")
+	remove := flag.Bool("delete", false, "delete each file after it is replayed")
+	flag.Parse()
+
+	l := lane.NewLogLane(nil)
+	l.SetPanicHandler(func() { os.Exit(1) })
+
+	if *pass == "" {
+		*pass = os.Getenv("OSL_PASSWORD")
+	}
+
+	files, err := listFiles(flag.Args())
+	if err != nil {
+		l.Fatal(err)
+	}
+	if len(files) == 0 {
+		l.Fatal("no emergency files specified")
+	}
+
+	cfg := osl.OslConfig{
+		OpenSearchProtocol: *protocol,
+		OpenSearchHost:     *host,
+		OpenSearchPort:     *port,
+		OpenSearchUser:     *user,
+		OpenSearchPass:     *pass,
+		OpenSearchIndex:    *index,
+		OpenSearchTransport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure}, // #nosec G402 -- opt-in by flag
+		},
+		MaxBufferSize:   *batchSize,
+		BackoffInterval: time.Second,
+		BackoffLimit:    *backoffLimit,
+	}
+
+	if *addresses != "" {
+		cfg.OpenSearchAddresses = strings.Split(*addresses, ",")
+	}
+
+	var sharderFn osl.OslMessageShardFn
+	if *shardFormat != "" {
+		sharderFn = func(baseName string, msg *osl.OslMessage) string {
+			// the index of the day the message was logged, rather than of the replay
+			t := msg.Timestamp()
+			if t.IsZero() {
+				t = time.Now()
+			}
+			return baseName + "-" + t.Format(*shardFormat)
+		}
+	}
+
+	emergencyFn := func(logBuffer []*osl.OslMessage) {
+		for _, msg := range logBuffer {
+			if msg.RejectReason != "" {
+				l.Warnf("rejected: %s: %s", msg.RejectReason, msg.LogMessage)
+			} else {
+				l.Warn(msg.LogMessage)
+			}
+		}
+	}
+
+	failed := false
+	for _, file := range files {
+		// the lines that can't be read are reported, and the rest are replayed; the
+		// file is kept for a look at the lines
+		messages, readErr := osl.ReadEmergencyFile(file)
+		if readErr != nil {
+			l.Error(readErr)
+			failed = true
+			if len(messages) == 0 {
+				continue
+			}
+		}
+
+		stats, err := osl.ReplayMessagesSharded(&cfg, messages, sharderFn, emergencyFn)
+		l.Infof("%s: %d messages, %d sent, %d failed", file, stats.MessagesQueued, stats.MessagesSent, stats.MessagesSentFailed)
+		if err != nil {
+			l.Error(err)
+			failed = true
+			continue
+		}
+
+		if *remove && stats.MessagesSentFailed == 0 && readErr == nil {
+			if err = os.Remove(file); err != nil {
+				l.Error(err)
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Expands directories into the emergency files they contain.
+func listFiles(args []string) (files []string, err error) {
+	for _, arg := range args {
+		info, statErr := os.Stat(arg)
+		if statErr != nil {
+			err = statErr
+			return
+		}
+
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		entries, readErr := os.ReadDir(arg)
+		if readErr != nil {
+			err = readErr
+			return
+		}
+
+		var dirFiles []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".ndjson") {
+				dirFiles = append(dirFiles, filepath.Join(arg, entry.Name()))
+			}
+		}
+		slices.Sort(dirFiles)
+		files = append(files, dirFiles...)
+	}
+
+	if len(files) == 0 && len(args) > 0 {
+		err = fmt.Errorf("no .ndjson files found in %s", strings.Join(args, ", "))
+	}
+	return
+}
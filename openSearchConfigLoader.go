@@ -0,0 +1,331 @@
+package osl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// The serializable form of OslConfig, as found in a config file or the environment.
+	// Durations are strings such as "10s", and secrets can be read from files.
+	oslConfigFile struct {
+		OpenSearchProtocol        string            `json:"openSearchProtocol"`
+		OpenSearchHost            string            `json:"openSearchHost"`
+		OpenSearchPort            int               `json:"openSearchPort"`
+		OpenSearchAddresses       []string          `json:"openSearchAddresses"`
+		OpenSearchUser            string            `json:"openSearchUser"`
+		OpenSearchPass            string            `json:"openSearchPass"`
+		OpenSearchPassFile        string            `json:"openSearchPassFile"`
+		OpenSearchApiKey          string            `json:"openSearchApiKey"`
+		OpenSearchApiKeyFile      string            `json:"openSearchApiKeyFile"`
+		OpenSearchBearerToken     string            `json:"openSearchBearerToken"`
+		OpenSearchBearerTokenFile string            `json:"openSearchBearerTokenFile"`
+		OpenSearchIndex           string            `json:"openSearchIndex"`
+		OpenSearchAppName         string            `json:"openSearchAppName"`
+		AwsSigV4                  *oslAwsSigV4File  `json:"awsSigV4"`
+		TlsCertFile               string            `json:"tlsCertFile"`
+		TlsKeyFile                string            `json:"tlsKeyFile"`
+		TlsCaFile                 string            `json:"tlsCaFile"`
+		TlsInsecureSkipVerify     bool              `json:"tlsInsecureSkipVerify"`
+		DeadNodeCooldown          oslDuration       `json:"deadNodeCooldown"`
+		LogThreshold              int               `json:"logThreshold"`
+		MaxBufferSize             int               `json:"maxBufferSize"`
+		OverflowPolicy            OslOverflowPolicy `json:"overflowPolicy"`
+		OverflowTimeout           oslDuration       `json:"overflowTimeout"`
+		EvictionOrder             []string          `json:"evictionOrder"`
+		FlushLevel                string            `json:"flushLevel"`
+		MinLevel                  string            `json:"minLevel"`
+		Routes                    []OslRoute        `json:"routes"`
+		DataStream                bool              `json:"dataStream"`
+		DataStreamTemplate        bool              `json:"dataStreamTemplate"`
+		FatalFlushTimeout         oslDuration       `json:"fatalFlushTimeout"`
+		BackoffInterval           oslDuration       `json:"backoffInterval"`
+		BackoffLimit              oslDuration       `json:"backoffLimit"`
+		OmitLogMessage            bool              `json:"omitLogMessage"`
+		SpoolDir                  string            `json:"spoolDir"`
+		SpoolSync                 OslSpoolSync      `json:"spoolSync"`
+		SpoolSegmentSize          int64             `json:"spoolSegmentSize"`
+		CompressRequests          bool              `json:"compressRequests"`
+		CompressionLevel          int               `json:"compressionLevel"`
+		MaxBulkBytes              int               `json:"maxBulkBytes"`
+		RequestTimeout            oslDuration       `json:"requestTimeout"`
+	}
+
+	oslAwsSigV4File struct {
+		Region  string `json:"region"`
+		Service string `json:"service"`
+	}
+
+	// A duration that is written as a string such as "1m30s", or a number of nanoseconds.
+	oslDuration time.Duration
+)
+
+var ErrConflictingSecret = errors.New("a secret and its file can't both be specified")
+
+// Loads the config from a JSON or YAML file; a file name ending in .yaml or .yml is YAML.
+// Durations are written as strings such as "10s" or "1m30s". The password, API key and
+// bearer token can be read from the files named by openSearchPassFile, openSearchApiKeyFile
+// and openSearchBearerTokenFile.
+//
+// When a host or addresses are specified, the transport is made from the TLS settings.
+// The config is validated the same as by NewOpenSearchLane.
+func LoadOslConfigFromFile(path string) (config *OslConfig, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		// YAML is converted to JSON so that there is one set of field names and rules
+		var doc any
+		if err = yaml.Unmarshal(data, &doc); err != nil {
+			err = fmt.Errorf("%s: %w", path, err)
+			return
+		}
+		if doc == nil {
+			doc = map[string]any{}
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			err = fmt.Errorf("%s: %w", path, err)
+			return
+		}
+	}
+
+	var file oslConfigFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&file); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+		return
+	}
+
+	return file.toConfig()
+}
+
+// Loads the config from environment variables named by prefix and the upper case form of
+// the config file field, such as OSL_OPENSEARCH_HOST for the prefix "OSL". Lists are comma
+// separated, routes are a JSON array, and the AWS settings are AWS_SIGV4_REGION and
+// AWS_SIGV4_SERVICE.
+func LoadOslConfigFromEnv(prefix string) (config *OslConfig, err error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	var file oslConfigFile
+	if _, err = loadEnvFields(reflect.ValueOf(&file).Elem(), prefix); err != nil {
+		return
+	}
+
+	return file.toConfig()
+}
+
+// Sets the fields of v from the environment. Returns true if any variable was found.
+func loadEnvFields(v reflect.Value, prefix string) (found bool, err error) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := prefix + envName(strings.Split(field.Tag.Get("json"), ",")[0])
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct {
+			nested := reflect.New(fv.Type().Elem())
+			var nestedFound bool
+			if nestedFound, err = loadEnvFields(nested.Elem(), name+"_"); err != nil {
+				return
+			}
+			if nestedFound {
+				fv.Set(nested)
+				found = true
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		found = true
+		if err = setFromString(fv, value); err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+			return
+		}
+	}
+	return
+}
+
+// Converts a camel case field name to the upper case name of an environment variable.
+func envName(fieldName string) string {
+	var sb strings.Builder
+	for i, r := range fieldName {
+		if i > 0 && unicode.IsUpper(r) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+
+	name := sb.String()
+	name = strings.ReplaceAll(name, "OPEN_SEARCH", "OPENSEARCH")
+	name = strings.ReplaceAll(name, "SIG_V4", "SIGV4")
+	return name
+}
+
+func setFromString(v reflect.Value, s string) (err error) {
+	if v.Type() == reflect.TypeOf(oslDuration(0)) {
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err == nil {
+			v.SetInt(int64(d))
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, 64); err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			// a list of structs is written as JSON
+			return json.Unmarshal([]byte(s), v.Addr().Interface())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		err = fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return
+}
+
+func (d *oslDuration) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(data, &s); err != nil {
+		// a number of nanoseconds, as time.Duration is marshaled
+		var n int64
+		if err = json.Unmarshal(data, &n); err != nil {
+			return
+		}
+		*d = oslDuration(n)
+		return
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return
+	}
+	*d = oslDuration(duration)
+	return
+}
+
+// Makes the OslConfig, reading the secret files and the TLS files.
+func (file *oslConfigFile) toConfig() (config *OslConfig, err error) {
+	cfg := OslConfig{
+		OpenSearchProtocol:    file.OpenSearchProtocol,
+		OpenSearchHost:        file.OpenSearchHost,
+		OpenSearchPort:        file.OpenSearchPort,
+		OpenSearchAddresses:   file.OpenSearchAddresses,
+		OpenSearchUser:        file.OpenSearchUser,
+		OpenSearchIndex:       file.OpenSearchIndex,
+		OpenSearchAppName:     file.OpenSearchAppName,
+		TlsCertFile:           file.TlsCertFile,
+		TlsKeyFile:            file.TlsKeyFile,
+		TlsCaFile:             file.TlsCaFile,
+		TlsInsecureSkipVerify: file.TlsInsecureSkipVerify,
+		DeadNodeCooldown:      time.Duration(file.DeadNodeCooldown),
+		LogThreshold:          file.LogThreshold,
+		MaxBufferSize:         file.MaxBufferSize,
+		OverflowPolicy:        file.OverflowPolicy,
+		OverflowTimeout:       time.Duration(file.OverflowTimeout),
+		EvictionOrder:         file.EvictionOrder,
+		FlushLevel:            file.FlushLevel,
+		MinLevel:              file.MinLevel,
+		Routes:                file.Routes,
+		DataStream:            file.DataStream,
+		DataStreamTemplate:    file.DataStreamTemplate,
+		FatalFlushTimeout:     time.Duration(file.FatalFlushTimeout),
+		BackoffInterval:       time.Duration(file.BackoffInterval),
+		BackoffLimit:          time.Duration(file.BackoffLimit),
+		OmitLogMessage:        file.OmitLogMessage,
+		SpoolDir:              file.SpoolDir,
+		SpoolSync:             file.SpoolSync,
+		SpoolSegmentSize:      file.SpoolSegmentSize,
+		CompressRequests:      file.CompressRequests,
+		CompressionLevel:      file.CompressionLevel,
+		MaxBulkBytes:          file.MaxBulkBytes,
+		RequestTimeout:        time.Duration(file.RequestTimeout),
+	}
+
+	if cfg.OpenSearchPass, err = readSecret(file.OpenSearchPass, file.OpenSearchPassFile); err != nil {
+		return
+	}
+	if cfg.OpenSearchApiKey, err = readSecret(file.OpenSearchApiKey, file.OpenSearchApiKeyFile); err != nil {
+		return
+	}
+	if cfg.OpenSearchBearerToken, err = readSecret(file.OpenSearchBearerToken, file.OpenSearchBearerTokenFile); err != nil {
+		return
+	}
+
+	if file.AwsSigV4 != nil {
+		cfg.AwsSigV4 = &OslAwsSigV4{
+			Region:  file.AwsSigV4.Region,
+			Service: file.AwsSigV4.Service,
+		}
+	}
+
+	if cfg.OpenSearchHost != "" || len(cfg.OpenSearchAddresses) > 0 {
+		if cfg.OpenSearchTransport, err = newTlsTransport(&cfg); err != nil {
+			return
+		}
+		cfg.madeTransport = cfg.OpenSearchTransport
+	}
+
+	if _, err = sanitizeConfig(&cfg); err != nil {
+		return
+	}
+
+	config = &cfg
+	return
+}
+
+// Returns the secret, or the content of the file that holds it, without trailing white space.
+func readSecret(secret, path string) (value string, err error) {
+	if path == "" {
+		value = secret
+		return
+	}
+	if secret != "" {
+		err = fmt.Errorf("%w: %s", ErrConflictingSecret, path)
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	value = strings.TrimRightFunc(string(data), unicode.IsSpace)
+	return
+}
@@ -0,0 +1,227 @@
+package osl
+
+import (
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Specifies the default interval at which a watched config file is checked for changes.
+	OslDefaultConfigPollInterval = 5 * time.Second
+)
+
+type (
+	configWatcher struct {
+		osl      *openSearchLane
+		path     string
+		interval time.Duration
+		modTime  time.Time
+		size     int64
+		tlsFiles map[string]fileStamp // TLS files of the current config
+		stopCh   chan struct{}
+		stopOnce sync.Once
+	}
+
+	// Identifies a version of a file; a missing file has the zero stamp.
+	fileStamp struct {
+		modTime time.Time
+		size    int64
+	}
+)
+
+// Watches the config file at path, and reconnects with its settings when they change. The
+// file is checked every interval, or OslDefaultConfigPollInterval if interval is zero, and
+// also upon SIGHUP if onSighup is true. The outcome of each reload is logged to the lane.
+// The TLS certificate, key and CA files of the config are checked too, and the lane
+// reconnects when one of them is replaced, even if the settings are the same.
+//
+// The file is read by LoadOslConfigFromFile. Call stop to end the watching; it also ends
+// when this lane is closed.
+func (osl *openSearchLane) WatchConfigFile(path string, interval time.Duration, onSighup bool) (stop func(), err error) {
+	if interval <= 0 {
+		interval = OslDefaultConfigPollInterval
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	cw := configWatcher{
+		osl:      osl,
+		path:     path,
+		interval: interval,
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+		stopCh:   make(chan struct{}),
+	}
+
+	osc := osl.openSearchConnection
+	osc.mu.Lock()
+	if osc.cfg != nil {
+		cw.tlsFiles = tlsFileStamps(osc.cfg.TlsCertFile, osc.cfg.TlsKeyFile, osc.cfg.TlsCaFile)
+	}
+	osc.mu.Unlock()
+
+	var sighupCh chan os.Signal
+	if onSighup {
+		sighupCh = make(chan os.Signal, 1)
+		signal.Notify(sighupCh, syscall.SIGHUP)
+	}
+
+	go cw.watch(sighupCh)
+
+	stop = func() {
+		cw.stopOnce.Do(func() { close(cw.stopCh) })
+	}
+	return
+}
+
+func (cw *configWatcher) watch(sighupCh chan os.Signal) {
+	ticker := time.NewTicker(cw.interval)
+	defer ticker.Stop()
+	if sighupCh != nil {
+		defer signal.Stop(sighupCh)
+	}
+
+	for {
+		select {
+		case <-cw.stopCh:
+			return
+
+		case <-cw.osl.closedCh:
+			return
+
+		case <-sighupCh:
+			cw.reload("SIGHUP", false)
+
+		case <-ticker.C:
+			info, err := os.Stat(cw.path)
+			if err != nil {
+				// the file may be in the middle of being replaced
+				continue
+			}
+			if !info.ModTime().Equal(cw.modTime) || info.Size() != cw.size {
+				cw.modTime = info.ModTime()
+				cw.size = info.Size()
+				cw.reload("file change", false)
+				continue
+			}
+
+			// the transport has to be made again to read a replaced TLS file
+			paths := make([]string, 0, len(cw.tlsFiles))
+			for path := range cw.tlsFiles {
+				paths = append(paths, path)
+			}
+			stamps := tlsFileStamps(paths...)
+			if !maps.Equal(stamps, cw.tlsFiles) {
+				cw.tlsFiles = stamps
+				cw.reload("TLS file change", true)
+			}
+		}
+	}
+}
+
+// Stats the files at paths, skipping empty paths.
+func tlsFileStamps(paths ...string) (stamps map[string]fileStamp) {
+	stamps = map[string]fileStamp{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		var stamp fileStamp
+		if info, err := os.Stat(path); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps[path] = stamp
+	}
+	return
+}
+
+// Loads the config file and reconnects if it differs from the current config, if one of
+// its TLS files was replaced, or if force is true.
+func (cw *configWatcher) reload(reason string, force bool) {
+	cfg, err := LoadOslConfigFromFile(cw.path)
+	if err != nil {
+		cw.osl.Errorf("OpenSearch config reload after %s failed: %v", reason, err)
+		return
+	}
+
+	stamps := tlsFileStamps(cfg.TlsCertFile, cfg.TlsKeyFile, cfg.TlsCaFile)
+	if !maps.Equal(stamps, cw.tlsFiles) {
+		cw.tlsFiles = stamps
+		force = true
+	}
+
+	osc := cw.osl.openSearchConnection
+	osc.mu.Lock()
+	current := osc.cfg
+	osc.mu.Unlock()
+
+	if current != nil {
+		carryOverConfig(cfg, current)
+	}
+
+	sanitized, err := sanitizeConfig(cfg)
+	if err != nil {
+		cw.osl.Errorf("OpenSearch config reload after %s failed: %v", reason, err)
+		return
+	}
+
+	if current != nil && !force && sameConfig(&sanitized, current) {
+		cw.osl.Debugf("OpenSearch config from %s is unchanged after %s", cw.path, reason)
+		return
+	}
+
+	if err = osc.connect(cfg); err != nil {
+		cw.osl.Errorf("OpenSearch reconnect with the config from %s failed: %v", cw.path, err)
+		return
+	}
+	if current != nil && current.OpenSearchTransport != nil && current.OpenSearchTransport != cfg.OpenSearchTransport {
+		current.OpenSearchTransport.CloseIdleConnections()
+	}
+	cw.osl.Infof("OpenSearch config reloaded from %s after %s", cw.path, reason)
+}
+
+// Copies the settings that a config file can't hold from the current config to cfg: the
+// credentials callback, unless the file configures another way to authenticate, the AWS
+// credentials callback, and the transport of the program, unless the file has TLS settings.
+// A transport made from the TLS settings is made again from those of the file.
+func carryOverConfig(cfg, current *OslConfig) {
+	otherAuth := cfg.OpenSearchUser != "" || cfg.OpenSearchPass != "" || cfg.OpenSearchApiKey != "" ||
+		cfg.OpenSearchBearerToken != "" || cfg.AwsSigV4 != nil
+	if cfg.Credentials == nil && !otherAuth {
+		cfg.Credentials = current.Credentials
+	}
+
+	if cfg.AwsSigV4 != nil && cfg.AwsSigV4.Credentials == nil && current.AwsSigV4 != nil {
+		cfg.AwsSigV4.Credentials = current.AwsSigV4.Credentials
+	}
+
+	if current.OpenSearchTransport != nil && current.OpenSearchTransport != current.madeTransport && !hasTlsSettings(cfg) {
+		cfg.OpenSearchTransport = current.OpenSearchTransport
+	}
+}
+
+// Compares the settings of two configs. The transport and callbacks are not compared,
+// because a config loaded from a file doesn't have them; see carryOverConfig.
+func sameConfig(a, b *OslConfig) bool {
+	ca := *a
+	cb := *b
+	for _, cfg := range []*OslConfig{&ca, &cb} {
+		cfg.OpenSearchTransport = nil
+		cfg.madeTransport = nil
+		cfg.Credentials = nil
+		if cfg.AwsSigV4 != nil {
+			sigV4 := *cfg.AwsSigV4
+			sigV4.Credentials = nil
+			cfg.AwsSigV4 = &sigV4
+		}
+	}
+	return reflect.DeepEqual(ca, cb)
+}
@@ -1,11 +1,17 @@
 package osl
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -21,16 +27,43 @@ type (
 		logBuffer          []*OslMessage
 		connectCh          chan *connectRequest
 		refChangeCh        chan *refRequest
+		flushCh            chan *flushRequest
 		wakeCh             chan struct{}
+		spaceCh            chan struct{} // closed when room is made in the buffer
+		stoppedCh          chan struct{}
 		emergencyFn        OslEmergencyFn
 		sharderFn          OslShardNameFn
+		messageSharderFn   OslMessageShardFn
 		messagesQueued     int
 		messagesSent       int
 		messagesSentFailed int
+		minLevel           string // MinLevel of the config, changed by SetMinLevel
+		messagesFiltered   int
+		droppedOverflow    int
+		overflowByLevel    map[string]int
+		indexStats         map[string]OslIndexStats
+		dataStreams        map[string]bool // indices known to be data streams
+		droppedBackoff     int
+		droppedFinal       int
+		messagesRejected   int
+		spoolFailed        int
+		batchRetries       int
+		bulkRequests       int
+		bulkRequestsFailed int
+		bytesSent          int64
+		lastError          string
+		lastErrorTime      time.Time
+		lastSendTime       time.Time
+		connected          bool
+		requestObservers   []*OslRequestObserverFn
 		pumpInterval       time.Duration
 		cfg                *OslConfig
 		flushing           *sync.WaitGroup
 		backoffDuration    time.Duration
+		spool              *openSearchSpool
+		nodes              *openSearchNodePool
+		ctx                context.Context
+		cancelRequests     context.CancelFunc
 	}
 
 	connectRequest struct {
@@ -42,10 +75,26 @@ type (
 	refRequest struct {
 		wg     sync.WaitGroup
 		change int
+		ctx    context.Context // bounds the final flush
+	}
+
+	flushRequest struct {
+		done     chan struct{}
+		count    int   // number of messages in the batch
+		deferred int   // number of messages to be sent again
+		err      error // failure of the batch
 	}
 
 	apiClient interface {
 		Bulk(ctx context.Context, req opensearchapi.BulkReq) (*opensearchapi.BulkResp, error)
+		DataStreamGet(ctx context.Context, req *opensearchapi.DataStreamGetReq) (*opensearchapi.DataStreamGetResp, error)
+		DataStreamCreate(ctx context.Context, req opensearchapi.DataStreamCreateReq) (*opensearchapi.DataStreamCreateResp, error)
+		IndexTemplateCreate(ctx context.Context, req opensearchapi.IndexTemplateCreateReq) (*opensearchapi.IndexTemplateCreateResp, error)
+	}
+
+	// The OpenSearch client, with the requests of apiClient that it groups by API.
+	openSearchApiClient struct {
+		*opensearchapi.Client
 	}
 )
 
@@ -55,10 +104,13 @@ func newOpenSearchConnection(config *OslConfig) (osc *openSearchConnection, err
 	connection := openSearchConnection{
 		logBuffer:    []*OslMessage{},
 		refChangeCh:  make(chan *refRequest, 1),
+		flushCh:      make(chan *flushRequest, 1),
 		wakeCh:       make(chan struct{}, 1),
+		stoppedCh:    make(chan struct{}),
 		connectCh:    make(chan *connectRequest, 1),
 		pumpInterval: time.Second,
 	}
+	connection.ctx, connection.cancelRequests = context.WithCancel(context.Background())
 
 	go connection.processConnection()
 
@@ -86,6 +138,54 @@ func (osc *openSearchConnection) setIndexSharder(sharderFn OslShardNameFn) (prio
 	return
 }
 
+func (osc *openSearchConnection) setMinLevel(level string) (prior string, err error) {
+	level, ok := normalizeLevel(level)
+	if !ok {
+		err = ErrInvalidMinLevel
+		return
+	}
+
+	osc.mu.Lock()
+	defer osc.mu.Unlock()
+	prior = osc.minLevel
+	osc.minLevel = level
+	return
+}
+
+// Returns true if a message of the level is to be sent to OpenSearch, and counts the
+// messages that are not. Messages without a known level are always sent.
+func (osc *openSearchConnection) passesMinLevel(level string) bool {
+	osc.mu.Lock()
+	defer osc.mu.Unlock()
+
+	if osc.minLevel == "" {
+		return true
+	}
+
+	severity := slices.Index(oslLevels, level)
+	if severity < 0 || severity >= slices.Index(oslLevels, osc.minLevel) {
+		return true
+	}
+	osc.messagesFiltered++
+	return false
+}
+
+// Returns the upper case form of a level name, and false if it isn't a lane log level.
+// The empty level is valid.
+func normalizeLevel(level string) (normalized string, ok bool) {
+	normalized = strings.ToUpper(level)
+	ok = normalized == "" || slices.Contains(oslLevels, normalized)
+	return
+}
+
+func (osc *openSearchConnection) setMessageSharder(sharderFn OslMessageShardFn) (prior OslMessageShardFn) {
+	osc.mu.Lock()
+	defer osc.mu.Unlock()
+	prior = osc.messageSharderFn
+	osc.messageSharderFn = sharderFn
+	return
+}
+
 func (osc *openSearchConnection) stats() (stats OslStats) {
 	osc.mu.Lock()
 	defer osc.mu.Unlock()
@@ -93,6 +193,26 @@ func (osc *openSearchConnection) stats() (stats OslStats) {
 	stats.MessagesQueued = osc.messagesQueued
 	stats.MessagesSent = osc.messagesSent
 	stats.MessagesSentFailed = osc.messagesSentFailed
+	stats.MessagesFiltered = osc.messagesFiltered
+	stats.MessagesDroppedOverflow = osc.droppedOverflow
+	stats.OverflowByLevel = maps.Clone(osc.overflowByLevel)
+	stats.MessagesDroppedBackoff = osc.droppedBackoff
+	stats.MessagesDroppedFinal = osc.droppedFinal
+	stats.MessagesRejected = osc.messagesRejected
+	stats.MessagesSpoolFailed = osc.spoolFailed
+	stats.BytesSent = osc.bytesSent
+	stats.BulkRequests = osc.bulkRequests
+	stats.BulkRequestsSucceeded = osc.bulkRequests - osc.bulkRequestsFailed
+	stats.BatchRetries = osc.batchRetries
+	stats.LastError = osc.lastError
+	stats.LastErrorTime = osc.lastErrorTime
+	stats.LastSendTime = osc.lastSendTime
+	stats.BackoffDuration = osc.backoffDuration
+	stats.Connected = osc.connected
+	stats.Indices = maps.Clone(osc.indexStats)
+	if osc.nodes != nil {
+		stats.Nodes = osc.nodes.stats()
+	}
 
 	return
 }
@@ -102,59 +222,299 @@ func (osc *openSearchConnection) log(msg OslMessage) {
 
 	osc.mu.Lock()
 
-	pending := osc.messagesQueued - osc.messagesSent
-	if pending >= osc.cfg.MaxBufferSize {
-		// have to drop messages
-		toRemove := (pending + 1) - osc.cfg.MaxBufferSize
-		inFlight := pending - len(osc.logBuffer)
-		cutPoint := toRemove + inFlight
-		if cutPoint > 0 {
-			if cutPoint >= len(osc.logBuffer) {
-				cutPoint = len(osc.logBuffer)
+	if msg.AppName == "" {
+		msg.AppName = osc.cfg.OpenSearchAppName
+	}
+	if osc.cfg.OmitLogMessage {
+		msg.LogMessage = ""
+	}
+	// during a backoff, the retry timer sends the message; sending it now would use up
+	// the backoff with each urgent message
+	urgent := slices.Index(oslLevels, msg.Level) >= slices.Index(oslLevels, osc.cfg.FlushLevel) &&
+		osc.backoffDuration == 0
+
+	if osc.spool != nil {
+		// the spool holds the messages on disk, so nothing is dropped for lack of space
+		err := osc.spool.append(&msg)
+		osc.messagesQueued++
+		if err != nil {
+			osc.messagesSentFailed++
+			osc.spoolFailed++
+		}
+		pending := osc.pending()
+		ef := osc.emergencyFn
+		osc.mu.Unlock()
+
+		if err != nil {
+			osc.emergencyLog("Error while writing to the spool: %v", err)
+			if ef != nil {
+				ef([]*OslMessage{&msg})
 			}
-			dropped = osc.logBuffer[:cutPoint]
-			osc.logBuffer = osc.logBuffer[cutPoint:]
+		} else if (pending % osc.cfg.LogThreshold) == 0 {
+			osc.wakeCh <- struct{}{}
+		} else if urgent {
+			osc.wake()
+		}
+		return
+	}
+
+	pending := osc.pending()
+	if osc.cfg.OverflowPolicy != OslOverflowDropOldest {
+		if !osc.waitForSpace() {
+			// no room - the new message is lost
+			osc.messagesQueued++
+			osc.countOverflow([]*OslMessage{&msg})
+			ef := osc.emergencyFn
+			order := osc.cfg.EvictionOrder
+			osc.mu.Unlock()
+
+			osc.reportOverflow(ef, []*OslMessage{&msg}, order)
+			return
 		}
 	}
 
-	msg.AppName = osc.cfg.OpenSearchAppName
-	osc.logBuffer = append(osc.logBuffer, &msg)
+	if osc.cfg.OverflowPolicy == OslOverflowDropOldest && pending >= osc.cfg.MaxBufferSize {
+		// have to drop messages - the new message is ranked with the buffered ones; a
+		// batch in flight can't be taken back
+		toRemove := min((pending+1)-osc.cfg.MaxBufferSize, len(osc.logBuffer)+1)
+		osc.logBuffer, dropped = evict(append(osc.logBuffer, &msg), toRemove, osc.cfg.EvictionOrder)
+		osc.countOverflow(dropped)
+	} else {
+		osc.logBuffer = append(osc.logBuffer, &msg)
+	}
 	osc.messagesQueued++
 
-	pending = osc.messagesQueued - osc.messagesSent
+	pending = osc.pending()
 	if (pending % osc.cfg.LogThreshold) == 0 {
 		osc.mu.Unlock()
 		osc.wakeCh <- struct{}{}
 	} else {
 		osc.mu.Unlock()
+		if urgent {
+			osc.wake()
+		}
 	}
 
 	if len(dropped) > 0 {
 		osc.mu.Lock()
-		osc.messagesSentFailed += len(dropped)
 		ef := osc.emergencyFn
+		order := osc.cfg.EvictionOrder
 		osc.mu.Unlock()
 
-		if ef != nil {
-			ef(dropped)
+		osc.reportOverflow(ef, dropped, order)
+	}
+}
+
+// Returns the number of messages that are neither sent nor counted as failed, whether they
+// are buffered or in a batch being sent. Called with osc.mu held.
+func (osc *openSearchConnection) pending() int {
+	return osc.messagesQueued - osc.messagesSent - osc.messagesSentFailed
+}
+
+// Passes the messages lost for lack of room to the emergency handler, followed by
+// the number lost of each level.
+func (osc *openSearchConnection) reportOverflow(ef OslEmergencyFn, dropped []*OslMessage, order []string) {
+	if ef != nil {
+		ef(dropped)
+	}
+
+	counts := map[string]int{}
+	levels := slices.Clone(order)
+	for _, msg := range dropped {
+		if !slices.Contains(levels, msg.Level) {
+			levels = append(levels, msg.Level)
+		}
+		counts[msg.Level]++
+	}
+
+	var parts []string
+	for _, level := range levels {
+		if counts[level] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[level], level))
+		}
+	}
+	osc.emergencyLog("Log buffer is full; evicted %s", strings.Join(parts, ", "))
+}
+
+// Removes n messages from the buffer: the lowest in the eviction order first, and the
+// oldest first within a level. Levels that aren't in the order are evicted last.
+func evict(buffer []*OslMessage, n int, order []string) (kept, evicted []*OslMessage) {
+	rank := func(msg *OslMessage) int {
+		if i := slices.Index(order, msg.Level); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+
+	counts := make([]int, len(order)+1)
+	for _, msg := range buffer {
+		counts[rank(msg)]++
+	}
+
+	// find the highest level that is evicted, and how many of its messages go
+	cutRank := 0
+	remaining := n
+	for remaining > counts[cutRank] {
+		remaining -= counts[cutRank]
+		cutRank++
+	}
+
+	kept = make([]*OslMessage, 0, len(buffer)-n)
+	evicted = make([]*OslMessage, 0, n)
+	for _, msg := range buffer {
+		r := rank(msg)
+		if r < cutRank || (r == cutRank && remaining > 0) {
+			if r == cutRank {
+				remaining--
+			}
+			evicted = append(evicted, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	return
+}
+
+// Counts messages lost for lack of room in the buffer. Called with osc.mu held.
+func (osc *openSearchConnection) countOverflow(dropped []*OslMessage) {
+	osc.messagesSentFailed += len(dropped)
+	osc.droppedOverflow += len(dropped)
+	if osc.overflowByLevel == nil {
+		osc.overflowByLevel = map[string]int{}
+	}
+	for _, msg := range dropped {
+		osc.overflowByLevel[msg.Level]++
+	}
+}
+
+// Waits for the buffer to have room for another message, as the overflow policy allows.
+// Returns false if there is no room. Called and returns with osc.mu held.
+func (osc *openSearchConnection) waitForSpace() bool {
+	var timeout <-chan time.Time
+
+	for osc.pending() >= osc.cfg.MaxBufferSize {
+		switch osc.cfg.OverflowPolicy {
+		case OslOverflowDropOldest:
+			// the policy changed while waiting
+			return true
+		case OslOverflowDropNewest:
+			return false
+		}
+
+		if !osc.connected {
+			// nothing drains the buffer while offline
+			return false
+		}
+
+		if timeout == nil && osc.cfg.OverflowPolicy == OslOverflowBlock {
+			timer := time.NewTimer(osc.cfg.OverflowTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		if osc.spaceCh == nil {
+			osc.spaceCh = make(chan struct{})
+		}
+		spaceCh := osc.spaceCh
+		osc.mu.Unlock()
+
+		// make sure the buffer is being drained
+		osc.wake()
+
+		select {
+		case <-spaceCh:
+			osc.mu.Lock()
+		case <-timeout:
+			osc.mu.Lock()
+			return false
+		case <-osc.stoppedCh:
+			osc.mu.Lock()
+			return false
 		}
 	}
+
+	return true
+}
+
+// Asks the processing task to send a batch, unless it has been asked already.
+func (osc *openSearchConnection) wake() {
+	select {
+	case osc.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Sends the buffered messages before the process exits upon a fatal error, waiting
+// up to FatalFlushTimeout.
+func (osc *openSearchConnection) flushBeforeExit() {
+	osc.mu.Lock()
+	timeout := osc.cfg.FatalFlushTimeout
+	osc.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := osc.flushNow(ctx); err != nil && !errors.Is(err, ErrNotConnected) {
+		osc.emergencyLog("Error while flushing before a fatal exit: %v", err)
+	}
+}
+
+// Wakes the log calls that wait for room in the buffer. Called with osc.mu held.
+func (osc *openSearchConnection) signalSpace() {
+	if osc.spaceCh != nil {
+		close(osc.spaceCh)
+		osc.spaceCh = nil
+	}
 }
 
 func (osc *openSearchConnection) connect(config *OslConfig) (err error) {
+	cfg, err := sanitizeConfig(config)
+	if err != nil {
+		return
+	}
+
+	// send it to the processing task
+	req := connectRequest{config: &cfg}
+	req.wg.Add(1)
+	osc.connectCh <- &req
+	req.wg.Wait()
+
+	return req.err
+}
+
+func sanitizeConfig(config *OslConfig) (cfg OslConfig, err error) {
 	// sanitize the config struct
-	cfg := OslConfig{}
 	if config == nil {
 		cfg.offline = true
 	} else {
 		cfg = *config
-		if cfg.OpenSearchHost == "" || cfg.OpenSearchTransport == nil {
+		if cfg.OpenSearchTransport != nil && cfg.OpenSearchTransport == cfg.madeTransport {
+			// made for a prior connection - made again, as the settings may have changed
+			cfg.OpenSearchTransport = nil
+		}
+		cfg.madeTransport = nil
+		if cfg.OpenSearchTransport != nil && hasTlsSettings(&cfg) {
+			err = ErrTransportWithTls
+			return
+		}
+		if cfg.OpenSearchHost == "" && len(cfg.OpenSearchAddresses) == 0 {
 			cfg.offline = true
+		} else if cfg.OpenSearchTransport == nil {
+			// make the transport from the TLS settings
+			if cfg.OpenSearchTransport, err = newTlsTransport(&cfg); err != nil {
+				return
+			}
+			cfg.madeTransport = cfg.OpenSearchTransport
 		}
 		if cfg.OpenSearchIndex == "" && !cfg.offline {
 			err = ErrIndexNameRequired
 			return
 		}
+		if cfg.OpenSearchIndex != "" {
+			if err = ValidateIndexName(cfg.OpenSearchIndex); err != nil {
+				return
+			}
+		}
 		if !cfg.offline {
 			if cfg.OpenSearchProtocol == "" {
 				cfg.OpenSearchProtocol = "https"
@@ -162,6 +522,13 @@ func (osc *openSearchConnection) connect(config *OslConfig) (err error) {
 			if cfg.OpenSearchPort == 0 {
 				cfg.OpenSearchPort = 9200
 			}
+			for _, address := range cfg.OpenSearchAddresses {
+				u, parseErr := url.Parse(address)
+				if parseErr != nil || u.Scheme == "" || u.Host == "" {
+					err = fmt.Errorf("%w: %s", ErrInvalidAddress, address)
+					return
+				}
+			}
 		}
 	}
 
@@ -171,25 +538,116 @@ func (osc *openSearchConnection) connect(config *OslConfig) (err error) {
 	if cfg.MaxBufferSize <= 0 {
 		cfg.MaxBufferSize = OslDefaultMaxBufferSize
 	}
+	switch cfg.OverflowPolicy {
+	case "":
+		cfg.OverflowPolicy = OslOverflowDropOldest
+	case OslOverflowDropOldest, OslOverflowDropNewest, OslOverflowBlock, OslOverflowBlockForever:
+	default:
+		err = ErrInvalidOverflowPolicy
+		return
+	}
+	var ok bool
+	if len(cfg.EvictionOrder) == 0 {
+		cfg.EvictionOrder = OslDefaultEvictionOrder
+	} else {
+		order := make([]string, 0, len(cfg.EvictionOrder))
+		for _, level := range cfg.EvictionOrder {
+			var normalized string
+			if normalized, ok = normalizeLevel(level); !ok || normalized == "" {
+				err = fmt.Errorf("%w: unknown level %q", ErrInvalidEvictionOrder, level)
+				return
+			}
+			order = append(order, normalized)
+		}
+		cfg.EvictionOrder = order
+	}
+	if cfg.FlushLevel, ok = normalizeLevel(cfg.FlushLevel); !ok {
+		err = ErrInvalidFlushLevel
+		return
+	}
+	if cfg.FlushLevel == "" {
+		cfg.FlushLevel = OslDefaultFlushLevel
+	}
+	if cfg.MinLevel, ok = normalizeLevel(cfg.MinLevel); !ok {
+		err = ErrInvalidMinLevel
+		return
+	}
+	if cfg.Routes, err = sanitizeRoutes(cfg.Routes); err != nil {
+		return
+	}
+	if cfg.FatalFlushTimeout <= 0 {
+		cfg.FatalFlushTimeout = OslDefaultFatalFlushTimeout
+	}
+	if cfg.OverflowTimeout <= 0 {
+		cfg.OverflowTimeout = OslDefaultOverflowTimeout
+	}
 	if cfg.BackoffInterval <= 0 {
 		cfg.BackoffInterval = OslDefaultBackoffInterval
 	}
 	if cfg.BackoffLimit <= 0 {
 		cfg.BackoffLimit = OslDefaultBackoffLimit
 	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = OslDefaultRequestTimeout
+	}
+	authMethods := 0
+	for _, configured := range []bool{
+		cfg.OpenSearchUser != "" || cfg.OpenSearchPass != "",
+		cfg.Credentials != nil,
+		cfg.OpenSearchApiKey != "",
+		cfg.OpenSearchBearerToken != "",
+		cfg.AwsSigV4 != nil,
+	} {
+		if configured {
+			authMethods++
+		}
+	}
+	if authMethods > 1 {
+		err = ErrMultipleAuthMethods
+		return
+	}
+	if cfg.AwsSigV4 != nil {
+		var sigV4 OslAwsSigV4
+		if sigV4, err = sanitizeSigV4(*cfg.AwsSigV4); err != nil {
+			return
+		}
+		cfg.AwsSigV4 = &sigV4
+	}
+	if cfg.DeadNodeCooldown <= 0 {
+		cfg.DeadNodeCooldown = OslDefaultDeadNodeCooldown
+	}
+	if cfg.MaxBulkBytes <= 0 {
+		cfg.MaxBulkBytes = OslDefaultMaxBulkBytes
+	}
+	if cfg.CompressRequests {
+		if cfg.CompressionLevel == 0 {
+			cfg.CompressionLevel = gzip.DefaultCompression
+		} else if cfg.CompressionLevel < gzip.HuffmanOnly || cfg.CompressionLevel > gzip.BestCompression {
+			err = ErrInvalidCompressionLevel
+			return
+		}
+	}
+	if cfg.SpoolDir != "" {
+		switch cfg.SpoolSync {
+		case "":
+			cfg.SpoolSync = OslSpoolSyncBatch
+		case OslSpoolSyncNone, OslSpoolSyncBatch, OslSpoolSyncAlways:
+		default:
+			err = ErrInvalidSpoolSync
+			return
+		}
+		if cfg.SpoolSegmentSize <= 0 {
+			cfg.SpoolSegmentSize = OslDefaultSpoolSegmentSize
+		}
+	}
 
-	// send it to the processing task
-	req := connectRequest{config: &cfg}
-	req.wg.Add(1)
-	osc.connectCh <- &req
-	req.wg.Wait()
-
-	return req.err
+	return
 }
 
 func (osc *openSearchConnection) processConnection() {
 	var client apiClient
 	refs := 0
+	defer close(osc.stoppedCh)
 
 	for {
 		osc.mu.Lock()
@@ -203,49 +661,86 @@ func (osc *openSearchConnection) processConnection() {
 		select {
 		case req := <-osc.connectCh:
 			// config change - make a new client
+			if req.err = osc.openSpool(req.config); req.err != nil {
+				req.wg.Done()
+				continue
+			}
+
 			osc.mu.Lock()
+			prior := osc.cfg
 			osc.cfg = req.config
+			osc.minLevel = req.config.MinLevel
 			osc.backoffDuration = 0
+			osc.dataStreams = nil // the new cluster may differ
 			osc.mu.Unlock()
 
-			if req.config.offline {
-				client = nil
-			} else {
-				client, req.err = newOpenSearchClient(
-					req.config.OpenSearchProtocol,
-					req.config.OpenSearchHost,
-					req.config.OpenSearchPort,
-					req.config.OpenSearchUser,
-					req.config.OpenSearchPass,
-					req.config.OpenSearchTransport,
-				)
+			if prior != nil && prior.madeTransport != nil && prior.madeTransport != req.config.OpenSearchTransport {
+				prior.madeTransport.CloseIdleConnections()
+			}
+
+			var nodes *openSearchNodePool
+			client = nil
+			if !req.config.offline {
+				if nodes, req.err = newNodePool(req.config); req.err == nil {
+					client = nodes
+				}
 			}
+
+			osc.mu.Lock()
+			osc.nodes = nodes
+			osc.connected = client != nil
+			osc.signalSpace() // the buffer size or policy may have changed
+			osc.mu.Unlock()
 			req.wg.Done()
 
 		case req := <-osc.refChangeCh:
 			// attach or detatch
 			refs += req.change
 			if refs <= 0 {
-				// last instance disconnected - drain and exit
-				osc.flush(client, true)
+				// last instance disconnected - drain and exit; requests are
+				// canceled if the drain takes longer than the caller allows
+				stop := context.AfterFunc(req.ctx, osc.cancelRequests)
+				osc.flush(client, true, nil)
+				for osc.hasSpoolBacklog(client) {
+					osc.flush(client, true, nil)
+				}
+				stop()
+				osc.cancelRequests()
+				osc.closeSpool()
 				req.wg.Done()
 				return
 			} else {
 				req.wg.Done()
 			}
 
+		case req := <-osc.flushCh:
+			// explicit request to send a batch - done outside of this task so
+			// that logging isn't held up while waiting for the response
+			if client == nil {
+				req.err = ErrNotConnected
+				close(req.done)
+				continue
+			}
+			go func(client apiClient) {
+				osc.flush(client, false, req)
+				close(req.done)
+			}(client)
+
 		case <-osc.wakeCh:
 			// log activity is backing up, drain
-			osc.flush(client, false)
+			osc.flush(client, false, nil)
 
 		case <-time.After(pumpInterval):
 			// regular wait time interval has expired - drain
-			osc.flush(client, false)
+			osc.flush(client, false, nil)
 		}
 	}
 }
 
-func (osc *openSearchConnection) flush(client apiClient, final bool) {
+// Sends a batch of the buffered messages. When req is not nil, the batch is sent after
+// any active flush completes, the call waits for the response, and the outcome of the
+// batch is recorded in req.
+func (osc *openSearchConnection) flush(client apiClient, final bool, req *flushRequest) {
 	// if not connected, don't do anything - unless this is the final call, for which
 	// anything unsent must be passed to the emergency write fn
 	if client == nil && !final {
@@ -256,13 +751,13 @@ func (osc *openSearchConnection) flush(client apiClient, final bool) {
 	for {
 		osc.mu.Lock()
 		if osc.flushing == nil {
-			osc.flushInner(client, final) // takes ownership of releasing osc.mu
+			osc.flushInner(client, final, req) // takes ownership of releasing osc.mu
 			return
 		}
 		pwg := osc.flushing
 		osc.mu.Unlock()
 
-		if !final {
+		if !final && req == nil {
 			// another flush is active; not final; continue on
 			return
 		}
@@ -272,10 +767,37 @@ func (osc *openSearchConnection) flush(client apiClient, final bool) {
 	}
 }
 
-func (osc *openSearchConnection) flushInner(client apiClient, final bool) {
+func (osc *openSearchConnection) flushInner(client apiClient, final bool, req *flushRequest) {
 	// currently holding lock on osc.mu
 	// must assign osc.flushing before releasing the lock (unless nothing to flush)
 
+	// when spooling, the next batch comes from disk
+	spool := osc.spool
+	if spool != nil {
+		if client == nil || osc.cfg.OpenSearchIndex == "" {
+			// messages stay in the spool until there is somewhere to send them
+			osc.mu.Unlock()
+			return
+		}
+
+		// read the batch as the flush owner, without holding up the log calls
+		var wg sync.WaitGroup
+		osc.flushing = &wg
+		wg.Add(1)
+		limit := osc.cfg.MaxBufferSize
+		osc.mu.Unlock()
+
+		msgs, err := spool.read(limit)
+		if err != nil {
+			osc.emergencyLog("Error while reading from the spool: %v", err)
+		}
+
+		osc.mu.Lock()
+		osc.flushing = nil
+		wg.Done()
+		osc.logBuffer = msgs
+	}
+
 	// take ownership of the log buffer (unless it is empty) and
 	// provide a new one for the next log messages to come while
 	// we're flushing what we have now
@@ -292,6 +814,9 @@ func (osc *openSearchConnection) flushInner(client apiClient, final bool) {
 	if client == nil || osc.cfg.OpenSearchIndex == "" {
 		// not connected; final must be true because of check in flush(), or no index is provided;
 		// save to emergency log
+		osc.messagesSentFailed += len(logBuffer)
+		osc.droppedFinal += len(logBuffer)
+		osc.signalSpace()
 		osc.mu.Unlock()
 		if ef != nil {
 			ef(logBuffer)
@@ -319,9 +844,26 @@ func (osc *openSearchConnection) flushInner(client apiClient, final bool) {
 			wg.Done()
 		}()
 
-		err := osc.bulkInsert(client, logBuffer)
+		retry, rejected, err := osc.bulkInsert(client, logBuffer)
+		unsent := retry
+		sent := len(logBuffer) - len(retry) - len(rejected)
+		retried := len(retry) > 0
+		batchErr := batchError(len(logBuffer), retry, rejected, err)
+
+		if req != nil {
+			req.count = len(logBuffer)
+			req.deferred = len(retry)
+			req.err = batchErr
+		}
+
+		// messages the server refused to index will never succeed - send to emergency log
+		if len(rejected) > 0 && ef != nil {
+			ef(rejected)
+		}
+
 		// upon a failure, try again after a backoff; and give up if it takes too long
-		if err != nil {
+		dropped := 0
+		if len(retry) > 0 {
 
 			if backoffDuration == 0 {
 				backoffDuration = osc.cfg.BackoffInterval
@@ -329,65 +871,352 @@ func (osc *openSearchConnection) flushInner(client apiClient, final bool) {
 				backoffDuration *= 2
 			}
 
-			if (backoffDuration > osc.cfg.BackoffLimit) || final {
+			if spool != nil {
+				// the spool keeps the messages; keep trying without giving up
+				backoffDuration = min(backoffDuration, osc.cfg.BackoffLimit)
+				if len(retry) == len(logBuffer) {
+					spool.rewind()
+				} else if err = spool.append(retry...); err == nil {
+					err = spool.commit()
+				}
+				if err != nil {
+					osc.emergencyLog("Error while updating the spool: %v", err)
+				}
+				retry = nil
+			} else if (backoffDuration > osc.cfg.BackoffLimit) || final {
 				// waited too long or is final - losing this set of messages - send to emergency log
 				backoffDuration = osc.cfg.BackoffInterval
 				if ef != nil {
-					ef(logBuffer)
+					ef(retry)
 				}
-				err = nil
-			}
-
-			osc.mu.Lock()
-			if err != nil {
-				// failed to send - put the messages back in the queue and retry
-				osc.logBuffer = append(logBuffer, osc.logBuffer...)
-			} else {
-				// dropped the messages
-				osc.messagesSentFailed += len(logBuffer)
+				dropped = len(retry)
+				retry = nil
 			}
-			osc.mu.Unlock()
 		} else {
-			osc.mu.Lock()
-			osc.messagesSent += len(logBuffer)
-			osc.mu.Unlock()
 			backoffDuration = 0
+			if spool != nil {
+				if err = spool.commit(); err != nil {
+					osc.emergencyLog("Error while updating the spool: %v", err)
+				}
+			}
+		}
+
+		osc.mu.Lock()
+		if len(retry) > 0 {
+			// failed to send - put the messages back in the queue and retry
+			osc.logBuffer = append(retry, osc.logBuffer...)
+		}
+		osc.messagesSent += sent
+		osc.messagesSentFailed += dropped + len(rejected)
+		osc.messagesRejected += len(rejected)
+		osc.countByIndex(logBuffer, unsent, rejected)
+		if final {
+			osc.droppedFinal += dropped
+		} else {
+			osc.droppedBackoff += dropped
+		}
+		if retried {
+			osc.batchRetries++
+		}
+		if batchErr != nil {
+			osc.lastError = batchErr.Error()
+			osc.lastErrorTime = time.Now()
+		}
+		if sent > 0 {
+			osc.lastSendTime = time.Now()
 		}
+		if sent+dropped+len(rejected) > 0 {
+			osc.signalSpace()
+		}
+		osc.mu.Unlock()
 	}()
 
-	// if final wait until goroutine is done
-	if final {
+	// if final or explicit, wait until goroutine is done
+	if final || req != nil {
 		wg.Wait()
 	}
 }
 
+// Describes the failure of a batch, or returns nil if the whole batch was sent.
+func batchError(count int, retry, rejected []*OslMessage, err error) error {
+	if err != nil {
+		return fmt.Errorf("batch of %d messages failed: %w", count, err)
+	}
+	if len(retry) > 0 {
+		return fmt.Errorf("batch of %d messages: %d deferred by the server", count, len(retry))
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("batch of %d messages: %d rejected: %s", count, len(rejected), rejected[0].RejectReason)
+	}
+	return nil
+}
+
+// Opens the spool configured by cfg, if it differs from the current one. Messages
+// buffered in memory are moved to the new spool; messages left in a prior spool
+// stay on disk.
+func (osc *openSearchConnection) openSpool(cfg *OslConfig) (err error) {
+	osc.mu.Lock()
+	current := osc.spool
+	osc.mu.Unlock()
+
+	if current == nil && cfg.SpoolDir == "" {
+		return
+	}
+	if current != nil && current.dir == cfg.SpoolDir && current.syncPolicy == cfg.SpoolSync && current.segmentSize == cfg.SpoolSegmentSize {
+		return
+	}
+
+	var spool *openSearchSpool
+	var recovered int
+	if cfg.SpoolDir != "" {
+		if spool, recovered, err = openSpool(cfg.SpoolDir, cfg.SpoolSync, cfg.SpoolSegmentSize); err != nil {
+			return
+		}
+	}
+
+	// wait for an active flush to finish with the current spool
+	for {
+		osc.mu.Lock()
+		if osc.flushing == nil {
+			break
+		}
+		pwg := osc.flushing
+		osc.mu.Unlock()
+		pwg.Wait()
+	}
+	defer osc.mu.Unlock()
+
+	if spool != nil && len(osc.logBuffer) > 0 {
+		if err = spool.append(osc.logBuffer...); err != nil {
+			_ = spool.close()
+			return
+		}
+		osc.logBuffer = []*OslMessage{}
+	}
+
+	if current != nil {
+		current.rewind()
+		if closeErr := current.close(); closeErr != nil {
+			osc.mu.Unlock()
+			osc.emergencyLog("Error while closing the spool: %v", closeErr)
+			osc.mu.Lock()
+		}
+	}
+
+	osc.spool = spool
+	osc.messagesQueued += recovered
+	return
+}
+
+func (osc *openSearchConnection) closeSpool() {
+	osc.mu.Lock()
+	spool := osc.spool
+	osc.spool = nil
+	osc.mu.Unlock()
+
+	if spool != nil {
+		if err := spool.close(); err != nil {
+			osc.emergencyLog("Error while closing the spool: %v", err)
+		}
+	}
+}
+
+// Returns true if the final flush should continue draining the spool; it stops
+// once the spool is empty or a send fails.
+func (osc *openSearchConnection) hasSpoolBacklog(client apiClient) bool {
+	osc.mu.Lock()
+	defer osc.mu.Unlock()
+
+	if client == nil || osc.spool == nil || osc.cfg.OpenSearchIndex == "" || osc.backoffDuration != 0 {
+		return false
+	}
+	return osc.spool.hasUnread()
+}
+
+// Sends batches until the messages queued at the time of the call are acknowledged, or
+// there is nothing left to send. The failures of the batches are returned, in which case
+// the unsent messages remain buffered for the regular retry. Stops early when ctx is done.
+func (osc *openSearchConnection) flushNow(ctx context.Context) (err error) {
+	select {
+	case <-osc.stoppedCh:
+		return ErrLaneClosed
+	default:
+	}
+
+	osc.mu.Lock()
+	target := osc.messagesQueued
+	osc.mu.Unlock()
+
+	for {
+		osc.mu.Lock()
+		finished := osc.messagesSent+osc.messagesSentFailed >= target
+		osc.mu.Unlock()
+		if finished {
+			return
+		}
+
+		req := flushRequest{done: make(chan struct{})}
+
+		select {
+		case osc.flushCh <- &req:
+		case <-osc.stoppedCh:
+			return errors.Join(err, ErrLaneClosed)
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+
+		select {
+		case <-req.done:
+		case <-osc.stoppedCh:
+			return errors.Join(err, ErrLaneClosed)
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+
+		// rejected messages are final, but a batch that must be retried
+		// is left to the backoff
+		err = errors.Join(err, req.err)
+		if req.count == 0 || req.deferred > 0 {
+			return
+		}
+	}
+}
+
 func (osc *openSearchConnection) attach() {
 	req := refRequest{
 		change: 1,
+		ctx:    context.Background(),
 	}
 	req.wg.Add(1)
 	osc.refChangeCh <- &req
 	req.wg.Wait()
 }
 
-func (osc *openSearchConnection) detach() {
+func (osc *openSearchConnection) detach(ctx context.Context) {
 	req := refRequest{
 		change: -1,
+		ctx:    ctx,
 	}
 	req.wg.Add(1)
 	osc.refChangeCh <- &req
 	req.wg.Wait()
 }
 
-func (osc *openSearchConnection) bulkInsert(client apiClient, logBuffer []*OslMessage) (err error) {
+// Sends logBuffer to OpenSearch, split into requests of no more than MaxBulkBytes. Messages
+// that should be sent again are returned in retry, and messages that OpenSearch refused are
+// returned in rejected. Upon an error, the messages that were not sent are in retry.
+func (osc *openSearchConnection) bulkInsert(client apiClient, logBuffer []*OslMessage) (retry, rejected []*OslMessage, err error) {
 
-	jsonData, err := osc.generateBulkJson(logBuffer)
+	lines, indices, err := osc.generateBulkLines(logBuffer)
 	if err != nil {
+		retry = logBuffer
 		return
 	}
 
-	data, err := client.Bulk(context.Background(), opensearchapi.BulkReq{Body: strings.NewReader(jsonData)})
+	if osc.cfg.DataStream {
+		// messages for a target that is not a data stream are refused before sending
+		var refused []*OslMessage
+		if logBuffer, lines, refused, err = osc.checkDataStreams(client, logBuffer, lines, indices); err != nil {
+			retry = logBuffer
+			return
+		}
+		rejected = refused
+	}
+
+	start := 0
+	size := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && (i == start || size+len(lines[i]) <= osc.cfg.MaxBulkBytes) {
+			size += len(lines[i])
+			continue
+		}
+		if i == start {
+			break
+		}
+
+		// send what has accumulated
+		chunkRetry, chunkRejected, chunkErr := osc.bulkSend(client, logBuffer[start:i], lines[start:i])
+		retry = append(retry, chunkRetry...)
+		rejected = append(rejected, chunkRejected...)
+		if chunkErr != nil {
+			// stop upon a failed request; the remaining messages are sent later
+			retry = append(retry, logBuffer[i:]...)
+			err = chunkErr
+			return
+		}
+
+		if i < len(lines) {
+			start = i
+			size = len(lines[i])
+		}
+	}
+
+	if len(retry) > 0 {
+		osc.emergencyLog("OpenSearch deferred %d of %d documents; will retry", len(retry), len(logBuffer))
+	}
+	return
+}
+
+// Sends a single bulk request. If OpenSearch responds that the request is too large, it is
+// split in half and each half is sent.
+func (osc *openSearchConnection) bulkSend(client apiClient, logBuffer []*OslMessage, lines []string) (retry, rejected []*OslMessage, err error) {
+	jsonData := strings.Join(lines, "")
+
+	body := []byte(jsonData)
+	var header http.Header
+	if osc.cfg.CompressRequests {
+		var buf bytes.Buffer
+		var zw *gzip.Writer
+		if zw, err = gzip.NewWriterLevel(&buf, osc.cfg.CompressionLevel); err == nil {
+			if _, err = zw.Write([]byte(jsonData)); err == nil {
+				err = zw.Close()
+			}
+		}
+		if err != nil {
+			osc.emergencyLog("Error compressing bulk request: %v", err)
+			retry = logBuffer
+			return
+		}
+		body = buf.Bytes()
+		header = http.Header{"Content-Encoding": []string{"gzip"}}
+	}
+
+	ctx := osc.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, osc.cfg.RequestTimeout)
+	defer cancel()
+
+	data, err := osc.bulkRequest(ctx, client, body, header, false)
+	if err != nil && osc.cfg.Credentials != nil && responseStatusCode(data, err) == http.StatusUnauthorized {
+		// the secret may have been rotated - fetch it again and retry the same request
+		data, err = osc.bulkRequest(ctx, client, body, header, true)
+	}
 	if err != nil {
+		if responseStatusCode(data, err) == http.StatusRequestEntityTooLarge {
+			if len(logBuffer) == 1 {
+				// can't be made any smaller
+				logBuffer[0].RejectReason = "request entity too large"
+				rejected = logBuffer
+				err = nil
+				return
+			}
+
+			half := len(logBuffer) / 2
+			retry, rejected, err = osc.bulkSend(client, logBuffer[:half], lines[:half])
+			if err != nil {
+				retry = append(retry, logBuffer[half:]...)
+				return
+			}
+
+			var retry2, rejected2 []*OslMessage
+			retry2, rejected2, err = osc.bulkSend(client, logBuffer[half:], lines[half:])
+			retry = append(retry, retry2...)
+			rejected = append(rejected, rejected2...)
+			return
+		}
+
 		// OpenSearch client assumes all negative responses have JSON bodies, but some, like 401 responses, have plain text.
 		if data != nil {
 			res := data.Inspect().Response
@@ -397,21 +1226,169 @@ func (osc *openSearchConnection) bulkInsert(client apiClient, logBuffer []*OslMe
 		}
 
 		osc.emergencyLog("Error while storing values in opensearch: %v", err)
+		retry = logBuffer
+		return
+	}
+
+	if data == nil || !data.Errors {
+		return
+	}
+
+	// some of the documents failed - the response items are in the same order as the request
+	if len(data.Items) != len(logBuffer) {
+		err = fmt.Errorf("bulk response has %d items for %d documents", len(data.Items), len(logBuffer))
+		osc.emergencyLog("Error while storing values in opensearch: %v", err)
+		retry = logBuffer
+		return
+	}
+
+	for i, item := range data.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+
+			switch result.Status {
+			case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+				retry = append(retry, logBuffer[i])
+			default:
+				reason := fmt.Sprintf("status %d", result.Status)
+				if result.Error != nil {
+					reason = fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason)
+				}
+				logBuffer[i].RejectReason = reason
+				rejected = append(rejected, logBuffer[i])
+			}
+		}
+	}
+
+	return
+}
+
+// Sends a bulk request body with the Authorization header of the config's API key, bearer
+// token or Credentials callback. The callback provides the user name and password of the
+// request; refresh asks it for fresh credentials.
+func (osc *openSearchConnection) bulkRequest(ctx context.Context, client apiClient, body []byte, header http.Header, refresh bool) (data *opensearchapi.BulkResp, err error) {
+	req := opensearchapi.BulkReq{Body: bytes.NewReader(body)}
+	if req.Header, err = osc.authorize(ctx, header, refresh); err != nil {
 		return
 	}
 
+	start := time.Now()
+	data, err = client.Bulk(ctx, req)
+	osc.recordRequest(time.Since(start), len(body), err)
+	return
+}
+
+// Returns a copy of header with the Authorization header of the config's API key, bearer
+// token or Credentials callback. refresh asks the callback for fresh credentials.
+func (osc *openSearchConnection) authorize(ctx context.Context, header http.Header, refresh bool) (authorized http.Header, err error) {
+	authorized = header.Clone()
+
+	var authorization string
+	switch {
+	case osc.cfg.OpenSearchApiKey != "":
+		authorization = "ApiKey " + osc.cfg.OpenSearchApiKey
+	case osc.cfg.OpenSearchBearerToken != "":
+		authorization = "Bearer " + osc.cfg.OpenSearchBearerToken
+	case osc.cfg.Credentials != nil:
+		user, pass, credErr := osc.cfg.Credentials(ctx, refresh)
+		if credErr != nil {
+			err = fmt.Errorf("can't obtain OpenSearch credentials: %w", credErr)
+			return
+		}
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+
+	if authorization != "" {
+		if authorized == nil {
+			authorized = http.Header{}
+		}
+		authorized.Set("Authorization", authorization)
+	}
 	return
 }
 
+// Counts a bulk request and its payload, and passes its duration to the request observers.
+func (osc *openSearchConnection) recordRequest(duration time.Duration, bytes int, err error) {
+	osc.mu.Lock()
+	osc.bulkRequests++
+	if err != nil {
+		osc.bulkRequestsFailed++
+	} else {
+		osc.bytesSent += int64(bytes)
+	}
+	observers := osc.requestObservers
+	osc.mu.Unlock()
+
+	for _, observerFn := range observers {
+		(*observerFn)(duration, err)
+	}
+}
+
+func (osc *openSearchConnection) observeRequests(observerFn OslRequestObserverFn) (stop func()) {
+	entry := &observerFn
+
+	// the list is replaced rather than changed, as recordRequest reads it without the lock
+	osc.mu.Lock()
+	osc.requestObservers = append(slices.Clip(osc.requestObservers), entry)
+	osc.mu.Unlock()
+
+	return func() {
+		osc.mu.Lock()
+		defer osc.mu.Unlock()
+		osc.requestObservers = slices.DeleteFunc(slices.Clone(osc.requestObservers), func(e *OslRequestObserverFn) bool {
+			return e == entry
+		})
+	}
+}
+
+// Returns the HTTP status of a failed request, or zero if it is not known.
+func responseStatusCode[T interface{ Inspect() opensearchapi.Inspect }](data *T, err error) int {
+	if data != nil {
+		res := (*data).Inspect().Response
+		if res != nil {
+			return res.StatusCode
+		}
+	}
+
+	var apiErr opensearchapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
+
 func (osc *openSearchConnection) generateBulkJson(logBuffer []*OslMessage) (jsonData string, err error) {
-	var lines []string
+	lines, _, err := osc.generateBulkLines(logBuffer)
+	if err != nil {
+		return
+	}
+
+	jsonData = strings.Join(lines, "")
+	return
+}
+
+// Makes the bulk request text for each message: the create action and the document,
+// each terminated by a newline. The index of each message is returned in indices.
+func (osc *openSearchConnection) generateBulkLines(logBuffer []*OslMessage) (lines, indices []string, err error) {
 	var createLine []byte
 	var logDataLine []byte
 
+	osc.mu.Lock()
+	cfg := osc.cfg
+	sharderFn := osc.sharderFn
+	messageSharderFn := osc.messageSharderFn
+	osc.mu.Unlock()
+
 	for _, logData := range logBuffer {
-		index := osc.cfg.OpenSearchIndex
-		if osc.sharderFn != nil && index != "" {
-			index = osc.sharderFn(index)
+		index := routeIndex(cfg, logData)
+		if index != "" {
+			if messageSharderFn != nil {
+				index = messageSharderFn(index, logData)
+			} else if sharderFn != nil {
+				index = sharderFn(index)
+			}
 		}
 		createAction := map[string]any{"create": map[string]any{"_index": index}}
 		createLine, err = json.Marshal(createAction)
@@ -420,31 +1397,42 @@ func (osc *openSearchConnection) generateBulkJson(logBuffer []*OslMessage) (json
 			return
 		}
 
-		logDataLine, err = json.Marshal(logData)
+		// the index override is not part of the document
+		doc := *logData
+		doc.Index = ""
+		if cfg.DataStream {
+			logDataLine, err = json.Marshal(newDataStreamDocument(&doc))
+		} else {
+			logDataLine, err = json.Marshal(&doc)
+		}
 		if err != nil {
 			osc.emergencyLog("Error marshalling logData JSON: %v", err)
 			return
 		}
 
-		lines = append(lines, string(createLine), string(logDataLine))
+		lines = append(lines, string(createLine)+"\n"+string(logDataLine)+"\n")
+		indices = append(indices, index)
 	}
 
-	jsonData = strings.Join(lines, "\n") + "\n"
-
 	return
 }
 
 func (osc *openSearchConnection) emergencyLog(formatStr string, args ...any) {
+	msg := fmt.Sprintf(formatStr, args...)
+
 	osc.mu.Lock()
 	ef := osc.emergencyFn
+	osc.lastError = msg
+	osc.lastErrorTime = time.Now()
 	osc.mu.Unlock()
 
 	if ef != nil {
-		msg := fmt.Sprintf(formatStr, args...)
 
 		oslm := &OslMessage{
 			AppName:    "OpenSearchLane",
 			LogMessage: msg,
+			Level:      "ERROR",
+			Message:    msg,
 		}
 
 		oslm.Metadata = make(map[string]string)
@@ -456,20 +1444,37 @@ func (osc *openSearchConnection) emergencyLog(formatStr string, args ...any) {
 	}
 }
 
-func realNewOpenSearchClient(protocol, host string, port int, user, pass string, transport *http.Transport) (client apiClient, err error) {
+func realNewOpenSearchClient(address string, cfg *OslConfig) (client apiClient, err error) {
+	clientCfg := opensearch.Config{
+		Transport: cfg.OpenSearchTransport,
+		Addresses: []string{address},
+		Username:  cfg.OpenSearchUser,
+		Password:  cfg.OpenSearchPass,
+	}
+	if cfg.AwsSigV4 != nil {
+		clientCfg.Signer = newSigV4Signer(cfg.AwsSigV4)
+	}
+
 	apicli, err := opensearchapi.NewClient(
 		opensearchapi.Config{
-			Client: opensearch.Config{
-				Transport: transport,
-				Addresses: []string{fmt.Sprintf("%s://%s:%d", protocol, host, port)},
-				Username:  user,
-				Password:  pass,
-			},
+			Client: clientCfg,
 		},
 	)
 	if err != nil {
 		return
 	}
-	client = apicli
+	client = &openSearchApiClient{apicli}
 	return
 }
+
+func (c *openSearchApiClient) DataStreamGet(ctx context.Context, req *opensearchapi.DataStreamGetReq) (*opensearchapi.DataStreamGetResp, error) {
+	return c.DataStream.Get(ctx, req)
+}
+
+func (c *openSearchApiClient) DataStreamCreate(ctx context.Context, req opensearchapi.DataStreamCreateReq) (*opensearchapi.DataStreamCreateResp, error) {
+	return c.DataStream.Create(ctx, req)
+}
+
+func (c *openSearchApiClient) IndexTemplateCreate(ctx context.Context, req opensearchapi.IndexTemplateCreateReq) (*opensearchapi.IndexTemplateCreateResp, error) {
+	return c.IndexTemplate.Create(ctx, req)
+}
@@ -0,0 +1,172 @@
+package osl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/v3/opensearchapi"
+)
+
+type (
+	// The document of a message in a data stream, which has the time of the message in
+	// a top-level @timestamp field.
+	dataStreamDocument struct {
+		AtTimestamp string `json:"@timestamp"`
+		*OslMessage
+	}
+)
+
+var ErrNotDataStream = errors.New("not an OpenSearch data stream")
+
+func newDataStreamDocument(msg *OslMessage) *dataStreamDocument {
+	t := msg.Timestamp()
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return &dataStreamDocument{AtTimestamp: t.UTC().Format(time.RFC3339Nano), OslMessage: msg}
+}
+
+// Checks that the indices of a batch are data streams. The messages of an index that is
+// not are taken out of the batch and returned in rejected. An index that is found to be
+// a data stream is not checked again until the next connect. Upon an error, nothing is
+// rejected and the whole batch should be sent again.
+func (osc *openSearchConnection) checkDataStreams(client apiClient, logBuffer []*OslMessage, lines, indices []string) (keptBuffer []*OslMessage, keptLines []string, rejected []*OslMessage, err error) {
+	keptBuffer = logBuffer
+	keptLines = lines
+
+	osc.mu.Lock()
+	var unchecked []string
+	for _, index := range indices {
+		if !osc.dataStreams[index] && !slices.Contains(unchecked, index) {
+			unchecked = append(unchecked, index)
+		}
+	}
+	osc.mu.Unlock()
+
+	failures := map[string]error{}
+	for _, index := range unchecked {
+		checkErr := osc.ensureDataStream(client, index)
+		if checkErr == nil {
+			osc.mu.Lock()
+			if osc.dataStreams == nil {
+				osc.dataStreams = map[string]bool{}
+			}
+			osc.dataStreams[index] = true
+			osc.mu.Unlock()
+			continue
+		}
+		if !errors.Is(checkErr, ErrNotDataStream) {
+			osc.emergencyLog("Error while checking data stream %s: %v", index, checkErr)
+			err = checkErr
+			return
+		}
+		failures[index] = checkErr
+	}
+
+	if len(failures) == 0 {
+		return
+	}
+
+	keptBuffer = make([]*OslMessage, 0, len(logBuffer))
+	keptLines = make([]string, 0, len(lines))
+	for i, msg := range logBuffer {
+		if failure, found := failures[indices[i]]; found {
+			msg.RejectReason = failure.Error()
+			rejected = append(rejected, msg)
+			continue
+		}
+		keptBuffer = append(keptBuffer, msg)
+		keptLines = append(keptLines, lines[i])
+	}
+	return
+}
+
+// Checks that name is a data stream. If it doesn't exist and DataStreamTemplate is set,
+// the data stream is created, along with an index template for it when no template
+// matches the name. An error that wraps ErrNotDataStream means that name can't be used;
+// any other error means that the check should be tried again later.
+func (osc *openSearchConnection) ensureDataStream(client apiClient, name string) (err error) {
+	ctx := osc.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, osc.cfg.RequestTimeout)
+	defer cancel()
+
+	statusCode, err := osc.dataStreamRequest(ctx, func(header http.Header) (int, error) {
+		data, err := client.DataStreamGet(ctx, &opensearchapi.DataStreamGetReq{DataStreams: []string{name}, Header: header})
+		if err == nil && !dataStreamListed(data, name) {
+			// an index or alias of the same name
+			return http.StatusOK, fmt.Errorf("%w: %s", ErrNotDataStream, name)
+		}
+		return responseStatusCode(data, err), err
+	})
+	if statusCode != http.StatusNotFound {
+		return
+	}
+
+	if !osc.cfg.DataStreamTemplate {
+		return fmt.Errorf("%w: %s does not exist", ErrNotDataStream, name)
+	}
+
+	// a template made by the cluster operator, or by a prior connection, is used as is
+	createFn := func(header http.Header) (int, error) {
+		data, err := client.DataStreamCreate(ctx, opensearchapi.DataStreamCreateReq{DataStream: name, Header: header})
+		return responseStatusCode(data, err), err
+	}
+	if statusCode, err = osc.dataStreamRequest(ctx, createFn); err == nil || !isClientError(statusCode) {
+		return
+	}
+
+	body := fmt.Sprintf(`{"index_patterns":[%q],"data_stream":{}}`, name)
+	statusCode, err = osc.dataStreamRequest(ctx, func(header http.Header) (int, error) {
+		req := opensearchapi.IndexTemplateCreateReq{IndexTemplate: name, Body: strings.NewReader(body), Header: header}
+		data, err := client.IndexTemplateCreate(ctx, req)
+		return responseStatusCode(data, err), err
+	})
+	if err == nil {
+		statusCode, err = osc.dataStreamRequest(ctx, createFn)
+	}
+	if err != nil && isClientError(statusCode) {
+		err = fmt.Errorf("%w: can't create %s: %w", ErrNotDataStream, name, err)
+	}
+	return
+}
+
+func dataStreamListed(data *opensearchapi.DataStreamGetResp, name string) bool {
+	for _, ds := range data.DataStreams {
+		if ds.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends a data stream request with the authorization of the config, asking the Credentials
+// callback for fresh credentials if OpenSearch refuses them. requestFn returns the HTTP
+// status and the error of the request.
+func (osc *openSearchConnection) dataStreamRequest(ctx context.Context, requestFn func(header http.Header) (int, error)) (statusCode int, err error) {
+	for _, refresh := range []bool{false, true} {
+		var header http.Header
+		if header, err = osc.authorize(ctx, nil, refresh); err != nil {
+			return
+		}
+		statusCode, err = requestFn(header)
+		if err == nil || osc.cfg.Credentials == nil || statusCode != http.StatusUnauthorized {
+			return
+		}
+	}
+	return
+}
+
+// Returns true if the status code of a failed request means that the request can't succeed
+// as it is, rather than that the cluster is unavailable.
+func isClientError(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 && statusCode != http.StatusUnauthorized &&
+		statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+}
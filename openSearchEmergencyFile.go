@@ -0,0 +1,191 @@
+package osl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Default size at which the emergency file handler starts a new file.
+	OslDefaultEmergencyFileSize = 16 * 1024 * 1024
+	// Default number of files kept by the emergency file handler.
+	OslDefaultEmergencyFileCount = 10
+
+	emergencyFilePrefix = "emergency-"
+	emergencyFileExt    = ".ndjson"
+)
+
+type (
+	emergencyFileWriter struct {
+		mu          sync.Mutex
+		dir         string
+		maxFileSize int64
+		maxFiles    int
+		files       []uint64
+		size        int64
+	}
+)
+
+// Makes an emergency handler that writes the messages to NDJSON files in dir, one
+// message per line. A new file is started when the current one reaches maxFileSize,
+// and the oldest files are deleted to keep no more than maxFiles. Zero selects the
+// default for maxFileSize or maxFiles.
+//
+// The files can be uploaded later with ReplayMessages, or the osl-replay command.
+func NewEmergencyFileHandler(dir string, maxFileSize int64, maxFiles int) (emergencyFn OslEmergencyFn, err error) {
+	if maxFileSize <= 0 {
+		maxFileSize = OslDefaultEmergencyFileSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = OslDefaultEmergencyFileCount
+	}
+
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return
+	}
+
+	efw := emergencyFileWriter{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+	}
+
+	// continue with the files of a prior process
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, emergencyFilePrefix) || !strings.HasSuffix(name, emergencyFileExt) {
+			continue
+		}
+		num, parseErr := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, emergencyFilePrefix), emergencyFileExt), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		efw.files = append(efw.files, num)
+	}
+	slices.Sort(efw.files)
+
+	if len(efw.files) > 0 {
+		info, statErr := os.Stat(efw.filePath(efw.files[len(efw.files)-1]))
+		if statErr == nil {
+			efw.size = info.Size()
+		}
+	}
+
+	emergencyFn = efw.write
+	return
+}
+
+func (efw *emergencyFileWriter) filePath(num uint64) string {
+	return filepath.Join(efw.dir, fmt.Sprintf("%s%020d%s", emergencyFilePrefix, num, emergencyFileExt))
+}
+
+func (efw *emergencyFileWriter) write(logBuffer []*OslMessage) {
+	efw.mu.Lock()
+	defer efw.mu.Unlock()
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	for _, msg := range logBuffer {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "osl: can't encode emergency message: %v\n", err)
+			continue
+		}
+		line = append(line, '\n')
+
+		if len(efw.files) == 0 || (efw.size > 0 && efw.size+int64(len(line)) > efw.maxFileSize) {
+			if f != nil {
+				f.Close()
+				f = nil
+			}
+			efw.rotate()
+		}
+
+		if f == nil {
+			f, err = os.OpenFile(efw.filePath(efw.files[len(efw.files)-1]), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "osl: can't open emergency file: %v\n", err)
+				return
+			}
+		}
+
+		n, err := f.Write(line)
+		efw.size += int64(n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "osl: can't write emergency file: %v\n", err)
+			return
+		}
+	}
+}
+
+func (efw *emergencyFileWriter) rotate() {
+	next := uint64(1)
+	if len(efw.files) > 0 {
+		next = efw.files[len(efw.files)-1] + 1
+	}
+	efw.files = append(efw.files, next)
+	efw.size = 0
+
+	for len(efw.files) > efw.maxFiles {
+		if err := os.Remove(efw.filePath(efw.files[0])); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "osl: can't remove emergency file: %v\n", err)
+		}
+		efw.files = efw.files[1:]
+	}
+}
+
+// Reads the messages of an NDJSON file written by the emergency file handler. A trailing
+// line without a line terminator was cut short by a crash, and is skipped unless it can be
+// decoded. Other lines that can't be decoded are skipped as well, and are described by err,
+// which is returned along with the messages that could be read.
+func ReadEmergencyFile(path string) (messages []*OslMessage, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	lineNumber := 0
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			err = errors.Join(err, fmt.Errorf("%s: %w", path, readErr))
+			return
+		}
+		lineNumber++
+		complete := readErr == nil
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var msg OslMessage
+			if decodeErr := json.Unmarshal(line, &msg); decodeErr == nil {
+				messages = append(messages, &msg)
+			} else if complete {
+				err = errors.Join(err, fmt.Errorf("%s line %d: %w", path, lineNumber, decodeErr))
+			}
+		}
+
+		if !complete {
+			return
+		}
+	}
+}
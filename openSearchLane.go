@@ -1,11 +1,13 @@
 package osl
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jimsnab/go-lane"
@@ -24,6 +26,53 @@ const (
 	// Specifies the default maximum duration for backoff intervals.
 	// Limits the time span within which backoff attempts are made before considering a connection or message sending attempt as failed.
 	OslDefaultBackoffLimit = 10 * time.Minute
+	// Specifies the default time limit of a bulk request.
+	OslDefaultRequestTimeout = 30 * time.Second
+	// Specifies the default time that a failed node is skipped before it is tried again.
+	OslDefaultDeadNodeCooldown = 30 * time.Second
+	// Specifies the default size limit of the body of a bulk request.
+	// A flush that is larger is sent as multiple bulk requests.
+	OslDefaultMaxBulkBytes = 10 * 1024 * 1024
+	// Specifies the default time that a log call waits for room in a full buffer
+	// under the OslOverflowBlock policy.
+	OslDefaultOverflowTimeout = 5 * time.Second
+	// Specifies the default minimum level of a log message that is sent right away.
+	OslDefaultFlushLevel = "ERROR"
+	// Specifies the default time limit of sending the buffered messages upon a fatal error.
+	OslDefaultFatalFlushTimeout = 5 * time.Second
+	// Specifies the default size limit of a spool segment file.
+	// The spool starts a new segment file when the current one reaches this size.
+	OslDefaultSpoolSegmentSize = 4 * 1024 * 1024
+)
+
+const (
+	// The spool leaves flushing to disk up to the operating system.
+	OslSpoolSyncNone OslSpoolSync = "none"
+	// The spool flushes to disk before each batch is sent to OpenSearch.
+	OslSpoolSyncBatch OslSpoolSync = "batch"
+	// The spool flushes to disk upon every log message.
+	OslSpoolSyncAlways OslSpoolSync = "always"
+)
+
+// The lane log levels, from the least severe. As with the lane log level, stack trace
+// lines pass any minimum level below STACK.
+var oslLevels = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL", "STACK"}
+
+// The default order in which a full buffer evicts messages by level: stack trace lines,
+// which can be many per error, and then the least severe first.
+var OslDefaultEvictionOrder = []string{"STACK", "TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+const (
+	// A full buffer makes room by passing the oldest messages of the first level of the
+	// eviction order to the emergency handler.
+	OslOverflowDropOldest OslOverflowPolicy = "drop-oldest"
+	// A full buffer passes the new message to the emergency handler.
+	OslOverflowDropNewest OslOverflowPolicy = "drop-newest"
+	// A log call waits up to OverflowTimeout for room in a full buffer, and then
+	// passes the new message to the emergency handler.
+	OslOverflowBlock OslOverflowPolicy = "block"
+	// A log call waits for room in a full buffer for as long as it takes.
+	OslOverflowBlockForever OslOverflowPolicy = "block-forever"
 )
 
 type (
@@ -34,21 +83,68 @@ type (
 	// Function invoked to decorate the index name (typically used for sharding)
 	OslShardNameFn func(baseName string) string
 
+	// Function invoked to decorate the index name of each message, such as by the time it
+	// was logged, its app, level or metadata
+	OslMessageShardFn func(baseName string, msg *OslMessage) string
+
+	// Function invoked with the duration of each bulk request to OpenSearch, such as to
+	// feed a metrics histogram. err is the failure of the request, if any.
+	OslRequestObserverFn func(duration time.Duration, err error)
+
+	// Function invoked for the user name and password of each request to OpenSearch. The
+	// function may return cached credentials, unless refresh is true, which means that
+	// OpenSearch refused the prior credentials.
+	OslCredentialsFn func(ctx context.Context, refresh bool) (user, pass string, err error)
+
+	// Policy for flushing the spool files to disk.
+	OslSpoolSync string
+
+	// Policy for a log message that arrives when the buffer is full.
+	OslOverflowPolicy string
+
 	// Configuration struct for OpenSearch connection settings.
 	OslConfig struct {
-		offline             bool
-		OpenSearchProtocol  string          `json:"openSearchProtocol"`
-		OpenSearchHost      string          `json:"openSearchHost"`
-		OpenSearchPort      int             `json:"openSearchPort"`
-		OpenSearchUser      string          `json:"openSearchUser"`
-		OpenSearchPass      string          `json:"openSearchPass"`
-		OpenSearchIndex     string          `json:"openSearchIndex"`
-		OpenSearchAppName   string          `json:"openSearchAppName"`
-		OpenSearchTransport *http.Transport `json:"openSearchTransport"`
-		LogThreshold        int             `json:"logThreshold,omitempty"`
-		MaxBufferSize       int             `json:"maxBufferSize,omitempty"`
-		BackoffInterval     time.Duration   `json:"backoffInterval,omitempty"`
-		BackoffLimit        time.Duration   `json:"backoffLimit,omitempty"`
+		offline               bool
+		madeTransport         *http.Transport   // the OpenSearchTransport made from the TLS settings
+		OpenSearchProtocol    string            `json:"openSearchProtocol"`
+		OpenSearchHost        string            `json:"openSearchHost"`
+		OpenSearchPort        int               `json:"openSearchPort"`
+		OpenSearchUser        string            `json:"openSearchUser"`
+		OpenSearchPass        string            `json:"openSearchPass"`
+		OpenSearchIndex       string            `json:"openSearchIndex"`
+		OpenSearchAppName     string            `json:"openSearchAppName"`
+		OpenSearchTransport   *http.Transport   `json:"openSearchTransport"`
+		OpenSearchAddresses   []string          `json:"openSearchAddresses,omitempty"`
+		DeadNodeCooldown      time.Duration     `json:"deadNodeCooldown,omitempty"`
+		AwsSigV4              *OslAwsSigV4      `json:"awsSigV4,omitempty"`
+		Credentials           OslCredentialsFn  `json:"-"`
+		OpenSearchApiKey      string            `json:"openSearchApiKey,omitempty"`
+		OpenSearchBearerToken string            `json:"openSearchBearerToken,omitempty"`
+		TlsCertFile           string            `json:"tlsCertFile,omitempty"`
+		TlsKeyFile            string            `json:"tlsKeyFile,omitempty"`
+		TlsCaFile             string            `json:"tlsCaFile,omitempty"`
+		TlsInsecureSkipVerify bool              `json:"tlsInsecureSkipVerify,omitempty"`
+		LogThreshold          int               `json:"logThreshold,omitempty"`
+		MaxBufferSize         int               `json:"maxBufferSize,omitempty"`
+		OverflowPolicy        OslOverflowPolicy `json:"overflowPolicy,omitempty"`
+		OverflowTimeout       time.Duration     `json:"overflowTimeout,omitempty"`
+		EvictionOrder         []string          `json:"evictionOrder,omitempty"`
+		FlushLevel            string            `json:"flushLevel,omitempty"`
+		MinLevel              string            `json:"minLevel,omitempty"`
+		Routes                []OslRoute        `json:"routes,omitempty"`
+		DataStream            bool              `json:"dataStream,omitempty"`
+		DataStreamTemplate    bool              `json:"dataStreamTemplate,omitempty"`
+		FatalFlushTimeout     time.Duration     `json:"fatalFlushTimeout,omitempty"`
+		BackoffInterval       time.Duration     `json:"backoffInterval,omitempty"`
+		BackoffLimit          time.Duration     `json:"backoffLimit,omitempty"`
+		OmitLogMessage        bool              `json:"omitLogMessage,omitempty"`
+		SpoolDir              string            `json:"spoolDir,omitempty"`
+		SpoolSync             OslSpoolSync      `json:"spoolSync,omitempty"`
+		SpoolSegmentSize      int64             `json:"spoolSegmentSize,omitempty"`
+		CompressRequests      bool              `json:"compressRequests,omitempty"`
+		CompressionLevel      int               `json:"compressionLevel,omitempty"`
+		MaxBulkBytes          int               `json:"maxBulkBytes,omitempty"`
+		RequestTimeout        time.Duration     `json:"requestTimeout,omitempty"`
 	}
 
 	// Struct representing a log message in OpenSearch.
@@ -58,7 +154,12 @@ type (
 		JourneyID    string            `json:"journeyId,omitempty"`
 		LaneID       string            `json:"laneId,omitempty"`
 		LogMessage   string            `json:"logMessage,omitempty"`
+		Level        string            `json:"level,omitempty"`
+		Prefix       string            `json:"prefix,omitempty"`
+		Message      string            `json:"message,omitempty"`
 		Metadata     map[string]string `json:"metadata,omitempty"`
+		RejectReason string            `json:"rejectReason,omitempty"`
+		Index        string            `json:"index,omitempty"` // set by a lane with an index override
 	}
 
 	// Struct holding statistics about message queues and sent messages in OpenSearch logging.
@@ -66,6 +167,42 @@ type (
 		MessagesQueued     int `json:"messagesQueued"`
 		MessagesSent       int `json:"messagesSent"`
 		MessagesSentFailed int `json:"messagesSentFailed"`
+		MessagesFiltered   int `json:"messagesFiltered"` // below MinLevel, not queued
+
+		// MessagesSentFailed is the sum of the reasons for failure that follow
+		MessagesDroppedOverflow int            `json:"messagesDroppedOverflow"`   // dropped because the buffer was full
+		OverflowByLevel         map[string]int `json:"overflowByLevel,omitempty"` // MessagesDroppedOverflow by level
+		MessagesDroppedBackoff  int            `json:"messagesDroppedBackoff"`    // dropped after BackoffLimit was exceeded
+		MessagesDroppedFinal    int            `json:"messagesDroppedFinal"`      // not sent by the time the lane closed
+		MessagesRejected        int            `json:"messagesRejected"`          // refused by OpenSearch
+		MessagesSpoolFailed     int            `json:"messagesSpoolFailed"`       // could not be written to the spool
+
+		BytesSent             int64         `json:"bytesSent"` // bulk request body bytes, as sent
+		BulkRequests          int           `json:"bulkRequests"`
+		BulkRequestsSucceeded int           `json:"bulkRequestsSucceeded"`
+		BatchRetries          int           `json:"batchRetries"` // batches that had to be sent again
+		LastError             string        `json:"lastError,omitempty"`
+		LastErrorTime         time.Time     `json:"lastErrorTime"`
+		LastSendTime          time.Time     `json:"lastSendTime"` // when messages were last stored by OpenSearch
+		BackoffDuration       time.Duration `json:"backoffDuration"`
+		Connected             bool          `json:"connected"`
+
+		Nodes   []OslNodeStats           `json:"nodes,omitempty"`
+		Indices map[string]OslIndexStats `json:"indices,omitempty"` // by index, before sharding
+	}
+
+	// Struct holding the request statistics of a node of the cluster.
+	OslNodeStats struct {
+		Address  string `json:"address"`
+		Requests int    `json:"requests"`
+		Failures int    `json:"failures"`
+		Dead     bool   `json:"dead"`
+	}
+
+	// Struct holding the message counts of an index.
+	OslIndexStats struct {
+		Sent     int `json:"sent"`
+		Rejected int `json:"rejected"`
 	}
 
 	// Struct representing a lane in OpenSearch logging.
@@ -73,19 +210,47 @@ type (
 		lane.LogLane
 		mu                   sync.Mutex
 		openSearchConnection *openSearchConnection
+		overrides            OslLaneOverrides
+		fatalCalls           atomic.Int32  // Fatal and PreFatal calls of this lane in progress
+		closedCh             chan struct{} // closed when the lane is closed
+		closeOnce            sync.Once
+	}
+
+	// Settings of a derived lane that differ from those of the connection. An empty
+	// setting is inherited from the parent lane.
+	OslLaneOverrides struct {
+		Index   string // used in place of OpenSearchIndex; routes still apply
+		AppName string // used in place of OpenSearchAppName
 	}
 
 	// Interface defining methods for a lane in OpenSearch logging.
 	OpenSearchLane interface {
 		lane.LogLane
 		Reconnect(config *OslConfig) (err error)
+		DeriveWithOverrides(overrides OslLaneOverrides) (l OpenSearchLane, err error)
+		CloseWithContext(ctx context.Context)
+		Flush(ctx context.Context) (err error)
+		WatchConfigFile(path string, interval time.Duration, onSighup bool) (stop func(), err error)
 		SetEmergencyHandler(emergencyFn OslEmergencyFn) (prior OslEmergencyFn)
 		SetIndexSharder(sharderFn OslShardNameFn) (prior OslShardNameFn)
+		SetMessageSharder(sharderFn OslMessageShardFn) (prior OslMessageShardFn)
+		SetMinLevel(level string) (prior string, err error)
+		ObserveRequests(observerFn OslRequestObserverFn) (stop func())
 		Stats() (stats OslStats)
 	}
 )
 
 var ErrIndexNameRequired = errors.New("an index name is required")
+var ErrInvalidSpoolSync = errors.New("invalid spool sync policy")
+var ErrInvalidOverflowPolicy = errors.New("invalid overflow policy")
+var ErrInvalidEvictionOrder = errors.New("invalid eviction order")
+var ErrInvalidFlushLevel = errors.New("invalid flush level")
+var ErrInvalidMinLevel = errors.New("invalid minimum level")
+var ErrInvalidCompressionLevel = errors.New("invalid compression level")
+var ErrInvalidAddress = errors.New("invalid OpenSearch address")
+var ErrMultipleAuthMethods = errors.New("only one authentication method can be configured")
+var ErrNotConnected = errors.New("not connected to OpenSearch")
+var ErrLaneClosed = errors.New("the OpenSearch lane is closed")
 
 func NewOpenSearchLane(ctx lane.OptionalContext, config *OslConfig) (l OpenSearchLane, err error) {
 
@@ -100,6 +265,9 @@ func NewOpenSearchLane(ctx lane.OptionalContext, config *OslConfig) (l OpenSearc
 	}
 
 	l = osl.(*openSearchLane)
+
+	// flush before the default panic; derived lanes inherit the handler
+	l.SetPanicHandler(nil)
 	return
 }
 
@@ -120,8 +288,10 @@ func createOpenSearchLane(config *OslConfig, parentLane lane.Lane) (newLane lane
 	} else {
 		// additional instance - bind to the existing connection
 		osl.openSearchConnection = posl.openSearchConnection
+		osl.overrides = posl.overrides
 	}
 
+	osl.closedCh = make(chan struct{})
 	osl.LogLane = lane.AllocEmbeddedLogLane()
 	osl.LogLane.SetFlagsMask(log.Ldate | log.Ltime)
 	osl.openSearchConnection.attach()
@@ -132,8 +302,45 @@ func createOpenSearchLane(config *OslConfig, parentLane lane.Lane) (newLane lane
 	return
 }
 
+// Derives a lane that writes to a different index, or with a different app name, than
+// the connection's. The lane shares the connection, and must be closed like any other
+// derived lane.
+func (osl *openSearchLane) DeriveWithOverrides(overrides OslLaneOverrides) (l OpenSearchLane, err error) {
+	if overrides.Index != "" {
+		if err = ValidateIndexName(overrides.Index); err != nil {
+			return
+		}
+	}
+
+	derived := osl.Derive().(*openSearchLane)
+	if overrides.Index != "" {
+		derived.overrides.Index = overrides.Index
+	}
+	if overrides.AppName != "" {
+		derived.overrides.AppName = overrides.AppName
+	}
+
+	l = derived
+	return
+}
+
 func (osl *openSearchLane) Close() {
-	osl.openSearchConnection.detach()
+	osl.CloseWithContext(context.Background())
+}
+
+// Closes the lane. If it is the last lane of the connection, waits for the buffered
+// messages to be sent, until ctx is done. Messages that could not be sent by then are
+// passed to the emergency handler.
+func (osl *openSearchLane) CloseWithContext(ctx context.Context) {
+	osl.closeOnce.Do(func() { close(osl.closedCh) })
+	osl.openSearchConnection.detach(ctx)
+}
+
+// Sends the messages buffered at the time of the call, and waits for OpenSearch to
+// acknowledge them or for ctx to be done. The failures of the batches are returned;
+// messages that could not be sent are retried as usual.
+func (osl *openSearchLane) Flush(ctx context.Context) (err error) {
+	return osl.openSearchConnection.flushNow(ctx)
 }
 
 func (osl *openSearchLane) Write(p []byte) (n int, err error) {
@@ -144,6 +351,11 @@ func (osl *openSearchLane) Write(p []byte) (n int, err error) {
 
 	logEntry = strings.TrimRight(logEntry, "\n")
 
+	level, prefix, message := parseLogLine(logEntry)
+	if !osl.openSearchConnection.passesMinLevel(level) {
+		return len(p), nil
+	}
+
 	parentLaneId, _ := osl.LogLane.Value(lane.ParentLaneIdKey).(string)
 
 	lm := osl.LogLane.(lane.LaneMetadata)
@@ -151,18 +363,117 @@ func (osl *openSearchLane) Write(p []byte) (n int, err error) {
 	mapCopy["timestamp"] = time.Now().UTC().Format(time.RFC3339)
 
 	logData := OslMessage{
+		AppName:      osl.overrides.AppName,
+		Index:        osl.overrides.Index,
 		ParentLaneId: parentLaneId,
 		JourneyID:    osl.JourneyId(),
 		LaneID:       osl.LaneId(),
 		LogMessage:   logEntry,
+		Level:        level,
+		Prefix:       prefix,
+		Message:      message,
 		Metadata:     mapCopy,
 	}
 
 	osl.openSearchConnection.log(logData)
 
+	if level == "FATAL" && osl.fatalCalls.Load() == 0 {
+		// a fatal error of a lane that this lane is a tee of; the process is about to
+		// exit, and there's no telling when the stack trace that may follow is done
+		osl.openSearchConnection.flushBeforeExit()
+	}
+
 	return len(p), nil
 }
 
+// Sets the function called after a fatal error is logged. The buffered messages, including
+// the stack trace of the error, are sent before the handler is called. A nil handler panics.
+func (osl *openSearchLane) SetPanicHandler(handler lane.Panic) {
+	if handler == nil {
+		handler = func() { panic("fatal error") }
+	}
+	osc := osl.openSearchConnection
+	osl.LogLane.SetPanicHandler(func() {
+		osc.flushBeforeExit()
+		handler()
+	})
+}
+
+// The fatal errors of the lane are sent by the panic handler, once the stack trace that
+// follows the error is written.
+
+func (osl *openSearchLane) Fatal(args ...any) {
+	osl.fatalCalls.Add(1)
+	defer osl.fatalCalls.Add(-1)
+	osl.LogLane.Fatal(args...)
+}
+
+func (osl *openSearchLane) Fatalf(format string, args ...any) {
+	osl.fatalCalls.Add(1)
+	defer osl.fatalCalls.Add(-1)
+	osl.LogLane.Fatalf(format, args...)
+}
+
+func (osl *openSearchLane) FatalObject(message string, obj any) {
+	osl.fatalCalls.Add(1)
+	defer osl.fatalCalls.Add(-1)
+	osl.LogLane.FatalObject(message, obj)
+}
+
+// The PreFatal calls send the buffered messages before returning, as the caller is
+// about to exit.
+
+func (osl *openSearchLane) PreFatal(args ...any) {
+	osl.fatalCalls.Add(1)
+	defer osl.fatalCalls.Add(-1)
+	osl.LogLane.PreFatal(args...)
+	osl.openSearchConnection.flushBeforeExit()
+}
+
+func (osl *openSearchLane) PreFatalf(format string, args ...any) {
+	osl.fatalCalls.Add(1)
+	defer osl.fatalCalls.Add(-1)
+	osl.LogLane.PreFatalf(format, args...)
+	osl.openSearchConnection.flushBeforeExit()
+}
+
+func (osl *openSearchLane) PreFatalObject(message string, obj any) {
+	osl.fatalCalls.Add(1)
+	defer osl.fatalCalls.Add(-1)
+	osl.LogLane.PreFatalObject(message, obj)
+	osl.openSearchConnection.flushBeforeExit()
+}
+
+// Returns the time the message was logged, from its timestamp metadata, or the zero
+// time if the message doesn't have one.
+func (msg *OslMessage) Timestamp() (t time.Time) {
+	t, _ = time.Parse(time.RFC3339, msg.Metadata["timestamp"])
+	return
+}
+
+// Splits a formatted lane log line such as "INFO {journey:lane} text" into
+// the level, the prefix (level and correlation IDs) and the message text.
+func parseLogLine(logEntry string) (level, prefix, message string) {
+	level, rest, found := strings.Cut(logEntry, " ")
+	if !found {
+		prefix = level
+		return
+	}
+
+	if strings.HasPrefix(rest, "{") {
+		cutPoint := strings.Index(rest, "} ")
+		if cutPoint >= 0 {
+			prefix = logEntry[:len(level)+1+cutPoint+1]
+			message = rest[cutPoint+2:]
+			return
+		}
+	}
+
+	prefix = level
+	message = rest
+	return
+}
+
 func (osl *openSearchLane) Stats() OslStats {
 	return osl.openSearchConnection.stats()
 }
@@ -174,3 +485,21 @@ func (osl *openSearchLane) SetEmergencyHandler(emergencyFn OslEmergencyFn) (prio
 func (osl *openSearchLane) SetIndexSharder(sharderFn OslShardNameFn) (prior OslShardNameFn) {
 	return osl.openSearchConnection.setIndexSharder(sharderFn)
 }
+
+// Sets the function that names the index of each message, in place of the index sharder.
+// Returns the prior message sharder.
+func (osl *openSearchLane) SetMessageSharder(sharderFn OslMessageShardFn) (prior OslMessageShardFn) {
+	return osl.openSearchConnection.setMessageSharder(sharderFn)
+}
+
+// Changes the minimum level of the messages sent to OpenSearch, without affecting the
+// tees. An empty level sends all messages. Returns the prior minimum level.
+func (osl *openSearchLane) SetMinLevel(level string) (prior string, err error) {
+	return osl.openSearchConnection.setMinLevel(level)
+}
+
+// Adds a function that is called with the duration of each bulk request of the lane's
+// connection, along with any observers added before. Call stop to remove it.
+func (osl *openSearchLane) ObserveRequests(observerFn OslRequestObserverFn) (stop func()) {
+	return osl.openSearchConnection.observeRequests(observerFn)
+}
@@ -1,10 +1,14 @@
 package osl
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"path"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -16,7 +20,7 @@ import (
 
 type (
 	testClient struct {
-		orgNewClient func(protocol, host string, port int, user, pass string, transport *http.Transport) (client apiClient, err error)
+		orgNewClient func(address string, cfg *OslConfig) (client apiClient, err error)
 		delay        time.Duration
 		failure      error
 		lines        []*OslMessage
@@ -24,28 +28,53 @@ type (
 		ll           lane.LogLane
 		count        atomic.Int32
 		indicies     []string
+		itemStatusFn func(msg *OslMessage) int
+		compressed   atomic.Int32
+		requests     atomic.Int32
+		maxBodyBytes int
+		dataStreams  []string // names of the data streams that exist
+		templates    []string // index patterns of the templates that make data streams
 		opensearchapi.Client
 	}
 )
 
 func (tc *testClient) Bulk(ctx context.Context, req opensearchapi.BulkReq) (*opensearchapi.BulkResp, error) {
 	if tc.delay > 0 {
-		time.Sleep(tc.delay)
+		select {
+		case <-time.After(tc.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
 	if tc.failure != nil {
 		return nil, tc.failure
 	}
 
-	buf := make([]byte, 64*1024)
-	n, err := req.Body.Read(buf)
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		body = zr
+		tc.compressed.Add(1)
+	}
+
+	buf, err := io.ReadAll(body)
 	if err != nil {
 		return nil, err
 	}
 
+	if tc.maxBodyBytes > 0 && len(buf) > tc.maxBodyBytes {
+		return nil, opensearchapi.Error{Status: http.StatusRequestEntityTooLarge}
+	}
+	tc.requests.Add(1)
+
 	newLines := []*OslMessage{}
+	resp := opensearchapi.BulkResp{}
 
-	lines := strings.Split(string(buf[:n]), "\n")
+	lines := strings.Split(string(buf), "\n")
 	for _, line := range lines {
 		if strings.TrimSpace(line) == "" {
 			continue
@@ -67,18 +96,82 @@ func (tc *testClient) Bulk(ctx context.Context, req opensearchapi.BulkReq) (*ope
 			return nil, err
 		}
 
-		newLines = append(newLines, &msg)
+		status := http.StatusCreated
+		if tc.itemStatusFn != nil {
+			status = tc.itemStatusFn(&msg)
+		}
+		item := opensearchapi.BulkRespItem{Status: status}
+		if status >= 300 {
+			resp.Errors = true
+			errJson := fmt.Sprintf(`{"status":%d,"error":{"type":"test_exception","reason":"status %d"}}`, status, status)
+			if err = json.Unmarshal([]byte(errJson), &item); err != nil {
+				return nil, err
+			}
+		} else {
+			newLines = append(newLines, &msg)
+		}
+		resp.Items = append(resp.Items, map[string]opensearchapi.BulkRespItem{"create": item})
 	}
 
 	tc.count.Add(int32(len(newLines)))
 	tc.lines = append(tc.lines, newLines...)
 
-	return &opensearchapi.BulkResp{}, nil
+	return &resp, nil
+}
+
+func (tc *testClient) DataStreamGet(ctx context.Context, req *opensearchapi.DataStreamGetReq) (*opensearchapi.DataStreamGetResp, error) {
+	if tc.failure != nil {
+		return nil, tc.failure
+	}
+
+	resp := opensearchapi.DataStreamGetResp{}
+	for _, name := range req.DataStreams {
+		if !slices.Contains(tc.dataStreams, name) {
+			return &resp, opensearchapi.Error{Status: http.StatusNotFound}
+		}
+		resp.DataStreams = append(resp.DataStreams, opensearchapi.DataStreamGetDetails{Name: name})
+	}
+	return &resp, nil
+}
+
+func (tc *testClient) DataStreamCreate(ctx context.Context, req opensearchapi.DataStreamCreateReq) (*opensearchapi.DataStreamCreateResp, error) {
+	if tc.failure != nil {
+		return nil, tc.failure
+	}
+
+	if slices.Contains(tc.dataStreams, req.DataStream) {
+		return nil, opensearchapi.Error{Status: http.StatusBadRequest}
+	}
+	for _, pattern := range tc.templates {
+		if matched, _ := path.Match(pattern, req.DataStream); matched {
+			tc.dataStreams = append(tc.dataStreams, req.DataStream)
+			return &opensearchapi.DataStreamCreateResp{Acknowledged: true}, nil
+		}
+	}
+	return nil, opensearchapi.Error{Status: http.StatusBadRequest}
+}
+
+func (tc *testClient) IndexTemplateCreate(ctx context.Context, req opensearchapi.IndexTemplateCreateReq) (*opensearchapi.IndexTemplateCreateResp, error) {
+	if tc.failure != nil {
+		return nil, tc.failure
+	}
+
+	var template struct {
+		IndexPatterns []string        `json:"index_patterns"`
+		DataStream    json.RawMessage `json:"data_stream"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&template); err != nil {
+		return nil, err
+	}
+	if template.DataStream != nil {
+		tc.templates = append(tc.templates, template.IndexPatterns...)
+	}
+	return &opensearchapi.IndexTemplateCreateResp{Acknowledged: true}, nil
 }
 
 func (tc *testClient) install(t *testing.T) {
 	tc.orgNewClient = newOpenSearchClient
-	newOpenSearchClient = func(protocol, host string, port int, user, pass string, transport *http.Transport) (client apiClient, err error) {
+	newOpenSearchClient = func(address string, cfg *OslConfig) (client apiClient, err error) {
 		client = tc
 		return
 	}
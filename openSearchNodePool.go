@@ -0,0 +1,206 @@
+package osl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/v3/opensearchapi"
+)
+
+type (
+	// Spreads bulk requests across the nodes of a cluster in round-robin order.
+	//
+	// A node that can't be reached, or that responds with a gateway error, is
+	// marked dead and the request is tried on the next node. A dead node is
+	// skipped until its cooldown expires. If all nodes are dead, the one that
+	// has been dead the longest is tried anyway.
+	openSearchNodePool struct {
+		mu       sync.Mutex
+		nodes    []*openSearchNode
+		next     int
+		cooldown time.Duration
+	}
+
+	openSearchNode struct {
+		address   string
+		client    apiClient
+		requests  int
+		failures  int
+		deadUntil time.Time
+	}
+)
+
+// Makes a client for each of the addresses of cfg.
+func newNodePool(cfg *OslConfig) (pool *openSearchNodePool, err error) {
+	addresses := cfg.OpenSearchAddresses
+	if len(addresses) == 0 {
+		addresses = []string{fmt.Sprintf("%s://%s:%d", cfg.OpenSearchProtocol, cfg.OpenSearchHost, cfg.OpenSearchPort)}
+	}
+
+	np := openSearchNodePool{cooldown: cfg.DeadNodeCooldown}
+	for _, address := range addresses {
+		var client apiClient
+		if client, err = newOpenSearchClient(address, cfg); err != nil {
+			return
+		}
+		np.nodes = append(np.nodes, &openSearchNode{address: address, client: client})
+	}
+
+	pool = &np
+	return
+}
+
+// Picks the node for the next request, skipping the nodes in tried.
+func (np *openSearchNodePool) pick(tried []*openSearchNode) (node *openSearchNode) {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+
+	now := time.Now()
+	for range np.nodes {
+		candidate := np.nodes[np.next]
+		np.next = (np.next + 1) % len(np.nodes)
+
+		if !candidate.deadUntil.After(now) && !nodeTried(tried, candidate) {
+			return candidate
+		}
+	}
+
+	// all nodes are dead; the first request may try the one with the earliest resurrection
+	if len(tried) > 0 {
+		return
+	}
+	for _, candidate := range np.nodes {
+		if node == nil || candidate.deadUntil.Before(node.deadUntil) {
+			node = candidate
+		}
+	}
+	return
+}
+
+func nodeTried(tried []*openSearchNode, node *openSearchNode) bool {
+	for _, t := range tried {
+		if t == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends the request to a live node, moving on to the next node when one fails.
+func (np *openSearchNodePool) Bulk(ctx context.Context, req opensearchapi.BulkReq) (data *opensearchapi.BulkResp, err error) {
+	np.send(ctx, rewindBody(req.Body), func(client apiClient) (int, error) {
+		data, err = client.Bulk(ctx, req)
+		return responseStatusCode(data, err), err
+	})
+	return
+}
+
+func (np *openSearchNodePool) DataStreamGet(ctx context.Context, req *opensearchapi.DataStreamGetReq) (data *opensearchapi.DataStreamGetResp, err error) {
+	np.send(ctx, nil, func(client apiClient) (int, error) {
+		data, err = client.DataStreamGet(ctx, req)
+		return responseStatusCode(data, err), err
+	})
+	return
+}
+
+func (np *openSearchNodePool) DataStreamCreate(ctx context.Context, req opensearchapi.DataStreamCreateReq) (data *opensearchapi.DataStreamCreateResp, err error) {
+	np.send(ctx, nil, func(client apiClient) (int, error) {
+		data, err = client.DataStreamCreate(ctx, req)
+		return responseStatusCode(data, err), err
+	})
+	return
+}
+
+func (np *openSearchNodePool) IndexTemplateCreate(ctx context.Context, req opensearchapi.IndexTemplateCreateReq) (data *opensearchapi.IndexTemplateCreateResp, err error) {
+	np.send(ctx, rewindBody(req.Body), func(client apiClient) (int, error) {
+		data, err = client.IndexTemplateCreate(ctx, req)
+		return responseStatusCode(data, err), err
+	})
+	return
+}
+
+// Calls requestFn with the client of a live node, moving on to the next node when the
+// node fails. The request is prepared to be sent again by rewind, which returns false if
+// it can't be; nil means there is nothing to prepare. requestFn returns the HTTP status
+// and the error of the request.
+func (np *openSearchNodePool) send(ctx context.Context, rewind func() bool, requestFn func(client apiClient) (int, error)) {
+	var tried []*openSearchNode
+
+	for {
+		node := np.pick(tried)
+		if node == nil {
+			return
+		}
+		tried = append(tried, node)
+
+		if len(tried) > 1 && rewind != nil && !rewind() {
+			return
+		}
+
+		statusCode, err := requestFn(node.client)
+
+		failed := err != nil && ctx.Err() == nil && isNodeFailure(statusCode, err)
+
+		np.mu.Lock()
+		node.requests++
+		if failed {
+			node.failures++
+			node.deadUntil = time.Now().Add(np.cooldown)
+		} else {
+			node.deadUntil = time.Time{}
+		}
+		np.mu.Unlock()
+
+		if !failed {
+			return
+		}
+	}
+}
+
+// Makes the rewind function of a request body, which was consumed by the prior attempt.
+func rewindBody(body io.Reader) func() bool {
+	return func() bool {
+		seeker, ok := body.(io.Seeker)
+		if !ok {
+			return false
+		}
+		_, err := seeker.Seek(0, io.SeekStart)
+		return err == nil
+	}
+}
+
+// Returns true if the status code of a failed request indicates that the node,
+// rather than the request, is the problem. Zero means there was no response, which
+// is not the fault of the node when the request couldn't be signed.
+func isNodeFailure(statusCode int, err error) bool {
+	if errors.Is(err, errSigning) {
+		return false
+	}
+
+	switch statusCode {
+	case 0, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (np *openSearchNodePool) stats() (stats []OslNodeStats) {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+
+	now := time.Now()
+	for _, node := range np.nodes {
+		stats = append(stats, OslNodeStats{
+			Address:  node.address,
+			Requests: node.requests,
+			Failures: node.failures,
+			Dead:     node.deadUntil.After(now),
+		})
+	}
+	return
+}
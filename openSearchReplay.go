@@ -0,0 +1,103 @@
+package osl
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrReplayOffline = errors.New("an OpenSearch connection is required to replay messages")
+
+// Uploads messages, such as those read by ReadEmergencyFile, with the connection
+// settings of config. The index name is decorated by sharderFn when it is not nil,
+// the same as it is for a lane.
+//
+// See ReplayMessagesSharded for the details.
+func ReplayMessages(config *OslConfig, messages []*OslMessage, sharderFn OslShardNameFn, emergencyFn OslEmergencyFn) (stats OslStats, err error) {
+	var messageSharderFn OslMessageShardFn
+	if sharderFn != nil {
+		messageSharderFn = func(baseName string, msg *OslMessage) string {
+			return sharderFn(baseName)
+		}
+	}
+	return ReplayMessagesSharded(config, messages, messageSharderFn, emergencyFn)
+}
+
+// Uploads messages, such as those read by ReadEmergencyFile, with the connection
+// settings of config. The index name of each message is decorated by sharderFn when
+// it is not nil, so that a message can be stored by the time it was logged.
+//
+// Messages are sent in batches of config.MaxBufferSize. Failed batches are retried
+// with the configured backoff; if config.BackoffLimit is exceeded the replay stops
+// with an error. Messages that OpenSearch rejects, and errors, are passed to
+// emergencyFn when it is not nil.
+func ReplayMessagesSharded(config *OslConfig, messages []*OslMessage, sharderFn OslMessageShardFn, emergencyFn OslEmergencyFn) (stats OslStats, err error) {
+	cfg, err := sanitizeConfig(config)
+	if err != nil {
+		return
+	}
+	if cfg.offline {
+		err = ErrReplayOffline
+		return
+	}
+
+	client, err := newNodePool(&cfg)
+	if err != nil {
+		return
+	}
+	defer func() {
+		stats.Nodes = client.stats()
+	}()
+
+	osc := openSearchConnection{
+		cfg:              &cfg,
+		messageSharderFn: sharderFn,
+		emergencyFn:      emergencyFn,
+	}
+
+	stats.MessagesQueued = len(messages)
+
+	for len(messages) > 0 {
+		batch := messages[:min(len(messages), cfg.MaxBufferSize)]
+		messages = messages[len(batch):]
+
+		// the reason for a prior rejection is not part of the document
+		for _, msg := range batch {
+			msg.RejectReason = ""
+		}
+
+		var backoffDuration time.Duration
+		for len(batch) > 0 {
+			retry, rejected, bulkErr := osc.bulkInsert(client, batch)
+
+			stats.MessagesSent += len(batch) - len(retry) - len(rejected)
+			stats.MessagesSentFailed += len(rejected)
+			if len(rejected) > 0 && emergencyFn != nil {
+				emergencyFn(rejected)
+			}
+
+			if len(retry) == 0 {
+				break
+			}
+
+			if backoffDuration == 0 {
+				backoffDuration = cfg.BackoffInterval
+			} else {
+				backoffDuration *= 2
+			}
+			if backoffDuration > cfg.BackoffLimit {
+				stats.MessagesSentFailed += len(retry) + len(messages)
+				if bulkErr == nil {
+					bulkErr = errors.New("documents deferred by the server")
+				}
+				err = fmt.Errorf("replay stopped after sending %d of %d messages: %w", stats.MessagesSent, stats.MessagesQueued, bulkErr)
+				return
+			}
+
+			time.Sleep(backoffDuration)
+			batch = retry
+		}
+	}
+
+	return
+}
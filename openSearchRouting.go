@@ -0,0 +1,103 @@
+package osl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+type (
+	// A rule that sends the messages it matches to an index other than OpenSearchIndex.
+	// A message matches when its level is at least MinLevel, and it has all of the
+	// Metadata values. A rule without conditions matches every message.
+	OslRoute struct {
+		Index    string            `json:"index"`
+		MinLevel string            `json:"minLevel,omitempty"`
+		Metadata map[string]string `json:"metadata,omitempty"`
+	}
+)
+
+var ErrInvalidRoute = errors.New("invalid route")
+
+// Returns the index of a message before sharding: the index of the first route that
+// matches, or the index of the lane that logged the message, or OpenSearchIndex.
+func routeIndex(cfg *OslConfig, msg *OslMessage) string {
+	for i := range cfg.Routes {
+		if cfg.Routes[i].matches(msg) {
+			return cfg.Routes[i].Index
+		}
+	}
+	if msg.Index != "" {
+		return msg.Index
+	}
+	return cfg.OpenSearchIndex
+}
+
+func (route *OslRoute) matches(msg *OslMessage) bool {
+	if route.MinLevel != "" {
+		// messages without a known level don't match
+		severity := slices.Index(oslLevels, msg.Level)
+		if severity < 0 || severity < slices.Index(oslLevels, route.MinLevel) {
+			return false
+		}
+	}
+
+	for key, value := range route.Metadata {
+		if actual, found := msg.Metadata[key]; !found || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks the routes, and makes a copy with the level names in upper case.
+func sanitizeRoutes(routes []OslRoute) (sanitized []OslRoute, err error) {
+	if len(routes) == 0 {
+		return
+	}
+
+	sanitized = make([]OslRoute, 0, len(routes))
+	for i, route := range routes {
+		if err = ValidateIndexName(route.Index); err != nil {
+			err = fmt.Errorf("%w %d: %w", ErrInvalidRoute, i, err)
+			return
+		}
+		var ok bool
+		if route.MinLevel, ok = normalizeLevel(route.MinLevel); !ok {
+			err = fmt.Errorf("%w %d: unknown level %s", ErrInvalidRoute, i, route.MinLevel)
+			return
+		}
+		sanitized = append(sanitized, route)
+	}
+	return
+}
+
+// Counts the messages of a batch by their index, before sharding. Called with osc.mu held.
+func (osc *openSearchConnection) countByIndex(logBuffer, retry, rejected []*OslMessage) {
+	if osc.indexStats == nil {
+		osc.indexStats = map[string]OslIndexStats{}
+	}
+
+	unsent := make(map[*OslMessage]bool, len(retry))
+	for _, msg := range retry {
+		unsent[msg] = true
+	}
+	refused := make(map[*OslMessage]bool, len(rejected))
+	for _, msg := range rejected {
+		refused[msg] = true
+	}
+
+	for _, msg := range logBuffer {
+		if unsent[msg] {
+			continue
+		}
+		index := routeIndex(osc.cfg, msg)
+		stats := osc.indexStats[index]
+		if refused[msg] {
+			stats.Rejected++
+		} else {
+			stats.Sent++
+		}
+		osc.indexStats[index] = stats
+	}
+}
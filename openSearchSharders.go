@@ -0,0 +1,109 @@
+package osl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// An index per hour.
+	OslShardHourly OslShardPeriod = "hourly"
+	// An index per day.
+	OslShardDaily OslShardPeriod = "daily"
+	// An index per week, starting on Monday.
+	OslShardWeekly OslShardPeriod = "weekly"
+	// An index per month.
+	OslShardMonthly OslShardPeriod = "monthly"
+
+	// OpenSearch limits the length of an index name in bytes.
+	maxIndexNameLength = 255
+)
+
+type (
+	// The time span covered by each index of a time sharder.
+	OslShardPeriod string
+)
+
+var ErrInvalidShardPeriod = errors.New("invalid shard period")
+var ErrInvalidIndexName = errors.New("invalid OpenSearch index name")
+
+// The default layouts of the index name suffix of each period. A week is named by the
+// date of its Monday.
+var shardLayouts = map[OslShardPeriod]string{
+	OslShardHourly:  "2006-01-02-15",
+	OslShardDaily:   time.DateOnly,
+	OslShardWeekly:  time.DateOnly,
+	OslShardMonthly: "2006-01",
+}
+
+// Makes a message sharder that names the index by the time each message was logged,
+// such as "logging-2024-12-31" for a daily index. The start of the period, in location,
+// is formatted by layout, a Go time layout, and appended to the base index name with a
+// hyphen. A nil location is UTC, and an empty layout selects the default for the period.
+//
+// The layout must make a lowercase suffix that is legal in an OpenSearch index name, so
+// month and day names can't be used.
+func NewTimeSharder(period OslShardPeriod, location *time.Location, layout string) (sharderFn OslMessageShardFn, err error) {
+	defaultLayout, ok := shardLayouts[period]
+	if !ok {
+		err = ErrInvalidShardPeriod
+		return
+	}
+	if layout == "" {
+		layout = defaultLayout
+	}
+	if location == nil {
+		location = time.UTC
+	}
+
+	// check the suffix with a time that has two digits in every field
+	sample := time.Date(2024, 12, 31, 23, 59, 59, 0, location)
+	if err = ValidateIndexName("index-" + sample.Format(layout)); err != nil {
+		return
+	}
+
+	sharderFn = func(baseName string, msg *OslMessage) string {
+		t := msg.Timestamp()
+		if t.IsZero() {
+			t = time.Now()
+		}
+		return baseName + "-" + periodStart(period, t.In(location)).Format(layout)
+	}
+	return
+}
+
+// Returns the start of the period that includes t, in the location of t.
+func periodStart(period OslShardPeriod, t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case OslShardHourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case OslShardWeekly:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	case OslShardMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// Checks that name is legal for an OpenSearch index: lowercase, no longer than 255 bytes,
+// not starting with "_", "-" or "+", and free of spaces and the characters \ / * ? " < > | , # :
+func ValidateIndexName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("%w: %q", ErrInvalidIndexName, name)
+	case len(name) > maxIndexNameLength:
+		return fmt.Errorf("%w: longer than %d bytes: %s", ErrInvalidIndexName, maxIndexNameLength, name)
+	case strings.ContainsAny(name[:1], "_-+"):
+		return fmt.Errorf("%w: starts with %q: %s", ErrInvalidIndexName, name[:1], name)
+	case strings.ToLower(name) != name:
+		return fmt.Errorf("%w: not lowercase: %s", ErrInvalidIndexName, name)
+	case strings.ContainsAny(name, "\\/*?\"<>| ,#:"):
+		return fmt.Errorf("%w: illegal character: %s", ErrInvalidIndexName, name)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package osl
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// AWS service name for Amazon OpenSearch Service domains.
+	OslAwsServiceOpenSearch = "es"
+	// AWS service name for Amazon OpenSearch Serverless collections.
+	OslAwsServiceServerless = "aoss"
+
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+)
+
+type (
+	// AWS credentials used to sign requests.
+	OslAwsCredentials struct {
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+	}
+
+	// Function invoked to obtain the AWS credentials for signing a request.
+	OslAwsCredentialsFn func(ctx context.Context) (creds OslAwsCredentials, err error)
+
+	// Settings for signing requests with AWS Signature Version 4.
+	OslAwsSigV4 struct {
+		Region      string              `json:"region,omitempty"`
+		Service     string              `json:"service,omitempty"`
+		Credentials OslAwsCredentialsFn `json:"-"`
+	}
+
+	// Signs each request to OpenSearch with AWS Signature Version 4.
+	sigV4Signer struct {
+		region      string
+		service     string
+		credentials OslAwsCredentialsFn
+		now         func() time.Time
+	}
+)
+
+var ErrAwsRegionRequired = errors.New("an AWS region is required for request signing")
+var ErrInvalidAwsService = errors.New("invalid AWS service name")
+var ErrAwsCredentialsRequired = errors.New("AWS credentials are required for request signing")
+
+// Wraps the errors of the signer, which are about the request rather than the node it is sent to.
+var errSigning = errors.New("AWS request signing")
+
+// Returns an OslAwsCredentialsFn that provides fixed credentials.
+func StaticAwsCredentials(accessKeyID, secretAccessKey, sessionToken string) OslAwsCredentialsFn {
+	return func(ctx context.Context) (creds OslAwsCredentials, err error) {
+		creds = OslAwsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			SessionToken:    sessionToken,
+		}
+		return
+	}
+}
+
+// Provides the credentials of the standard AWS environment variables AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. The variables are read for each request.
+func EnvAwsCredentials(ctx context.Context) (creds OslAwsCredentials, err error) {
+	creds = OslAwsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		err = ErrAwsCredentialsRequired
+	}
+	return
+}
+
+// Fills in the defaults of the signing settings: the region from AWS_REGION or
+// AWS_DEFAULT_REGION, the "es" service and the environment credentials.
+func sanitizeSigV4(sigV4 OslAwsSigV4) (cfg OslAwsSigV4, err error) {
+	cfg = sigV4
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		err = ErrAwsRegionRequired
+		return
+	}
+
+	switch cfg.Service {
+	case "":
+		cfg.Service = OslAwsServiceOpenSearch
+	case OslAwsServiceOpenSearch, OslAwsServiceServerless:
+	default:
+		err = ErrInvalidAwsService
+		return
+	}
+
+	if cfg.Credentials == nil {
+		cfg.Credentials = EnvAwsCredentials
+	}
+	return
+}
+
+func newSigV4Signer(cfg *OslAwsSigV4) *sigV4Signer {
+	return &sigV4Signer{
+		region:      cfg.Region,
+		service:     cfg.Service,
+		credentials: cfg.Credentials,
+		now:         time.Now,
+	}
+}
+
+// Implements the opensearch-go signer.Signer interface.
+func (s *sigV4Signer) SignRequest(req *http.Request) (err error) {
+	creds, err := s.credentials(req.Context())
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSigning, err)
+	}
+
+	payloadHash, err := hashRequestBody(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSigning, err)
+	}
+
+	// OpenSearch Serverless requires the payload hash header
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	s.sign(req, creds, payloadHash, s.now().UTC())
+	return
+}
+
+// Adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers to req. The host and
+// all of the X-Amz headers are signed.
+func (s *sigV4Signer) sign(req *http.Request, creds OslAwsCredentials, payloadHash string, t time.Time) {
+	amzDate := t.Format(sigV4TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.Join(values, ",")
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format(sigV4DateFormat), s.region, s.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hexSha256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+creds.SecretAccessKey), t.Format(sigV4DateFormat))
+	key = hmacSha256(key, s.region)
+	key = hmacSha256(key, s.service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", sigV4Algorithm+" Credential="+creds.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// Hashes the request body, leaving the body readable for sending.
+func hashRequestBody(req *http.Request) (hash string, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hexSha256(nil), nil
+	}
+
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		if body, err = req.GetBody(); err != nil {
+			return
+		}
+	} else {
+		body = req.Body
+	}
+
+	data, err := io.ReadAll(body)
+	if closeErr := body.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	if req.GetBody == nil {
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return hexSha256(data), nil
+}
+
+func canonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = sigV4Escape(unescaped)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key)+"="+sigV4Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Escapes everything but the RFC 3986 unreserved characters.
+func sigV4Escape(s string) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+		}
+	}
+	return sb.String()
+}
+
+func hexSha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,393 @@
+package osl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Extension of the spool segment files.
+	spoolSegmentExt = ".ndjson"
+	// Name of the file that records how much of the spool has been acknowledged.
+	spoolCheckpointName = "checkpoint.json"
+)
+
+type (
+	// Write-ahead spool of log messages, stored as a series of NDJSON segment files.
+	//
+	// Messages are appended to the newest segment. Reading starts at the oldest
+	// unacknowledged message; a read batch is either committed, which deletes the
+	// segments that have been fully consumed, or rewound so it is read again.
+	openSearchSpool struct {
+		mu          sync.Mutex
+		dir         string
+		syncPolicy  OslSpoolSync
+		segmentSize int64
+		segments    []uint64
+		writeFile   *os.File
+		writeSize   int64
+		readPos     spoolPosition
+		commitPos   spoolPosition
+	}
+
+	spoolPosition struct {
+		Segment uint64 `json:"segment"`
+		Offset  int64  `json:"offset"`
+	}
+)
+
+// Opens the spool in dir, creating the directory if needed. Any messages left
+// over from a prior process are retained; recovered is the number of them.
+func openSpool(dir string, syncPolicy OslSpoolSync, segmentSize int64) (spool *openSearchSpool, recovered int, err error) {
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return
+	}
+
+	sp := openSearchSpool{
+		dir:         dir,
+		syncPolicy:  syncPolicy,
+		segmentSize: segmentSize,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seg, parseErr := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		sp.segments = append(sp.segments, seg)
+	}
+	slices.Sort(sp.segments)
+
+	// resume where the prior process left off
+	data, readErr := os.ReadFile(filepath.Join(dir, spoolCheckpointName))
+	if readErr == nil {
+		if json.Unmarshal(data, &sp.commitPos) != nil {
+			sp.commitPos = spoolPosition{}
+		}
+	}
+	if len(sp.segments) > 0 && !slices.Contains(sp.segments, sp.commitPos.Segment) {
+		sp.commitPos = spoolPosition{Segment: sp.segments[0]}
+	}
+	sp.readPos = sp.commitPos
+
+	// segments before the checkpoint were fully acknowledged
+	if err = sp.removeSegmentsBefore(sp.commitPos.Segment); err != nil {
+		return
+	}
+
+	if recovered, err = sp.countUnread(); err != nil {
+		return
+	}
+
+	// always write to a fresh segment so a partial line from a crash is never extended
+	next := uint64(1)
+	if len(sp.segments) > 0 {
+		next = sp.segments[len(sp.segments)-1] + 1
+	}
+	if err = sp.startSegment(next); err != nil {
+		return
+	}
+	if len(sp.segments) == 1 {
+		sp.commitPos = spoolPosition{Segment: next}
+		sp.readPos = sp.commitPos
+	}
+
+	spool = &sp
+	return
+}
+
+func (sp *openSearchSpool) segmentPath(seg uint64) string {
+	return filepath.Join(sp.dir, fmt.Sprintf("%020d%s", seg, spoolSegmentExt))
+}
+
+func (sp *openSearchSpool) startSegment(seg uint64) (err error) {
+	f, err := os.OpenFile(sp.segmentPath(seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+
+	if sp.writeFile != nil {
+		if sp.syncPolicy != OslSpoolSyncNone {
+			_ = sp.writeFile.Sync()
+		}
+		_ = sp.writeFile.Close()
+	}
+
+	sp.writeFile = f
+	sp.writeSize = 0
+	sp.segments = append(sp.segments, seg)
+	return
+}
+
+func (sp *openSearchSpool) writeSegment() uint64 {
+	return sp.segments[len(sp.segments)-1]
+}
+
+func (sp *openSearchSpool) removeSegmentsBefore(seg uint64) (err error) {
+	kept := sp.segments[:0]
+	for _, s := range sp.segments {
+		if s < seg {
+			if removeErr := os.Remove(sp.segmentPath(s)); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+				err = errors.Join(err, removeErr)
+			}
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	sp.segments = kept
+	return
+}
+
+// Counts the complete messages from the read position to the end of the spool.
+func (sp *openSearchSpool) countUnread() (count int, err error) {
+	for _, seg := range sp.segments {
+		if seg < sp.readPos.Segment {
+			continue
+		}
+
+		var offset int64
+		if seg == sp.readPos.Segment {
+			offset = sp.readPos.Offset
+		}
+
+		err = sp.scanSegment(seg, offset, func(line []byte) bool {
+			count++
+			return true
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Invokes fn for each complete line of the segment, starting at offset, until fn returns false.
+// A trailing line without a line terminator is not complete and is not passed to fn.
+func (sp *openSearchSpool) scanSegment(seg uint64, offset int64, fn func(line []byte) bool) (err error) {
+	f, err := os.Open(sp.segmentPath(seg))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				err = readErr
+			}
+			return
+		}
+		if !fn(line) {
+			return
+		}
+	}
+}
+
+// Appends messages to the end of the spool.
+func (sp *openSearchSpool) append(msgs ...*OslMessage) (err error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for _, msg := range msgs {
+		var line []byte
+		line, err = json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		line = append(line, '\n')
+
+		if sp.writeSize > 0 && sp.writeSize+int64(len(line)) > sp.segmentSize {
+			if err = sp.startSegment(sp.writeSegment() + 1); err != nil {
+				return
+			}
+		}
+
+		var n int
+		n, err = sp.writeFile.Write(line)
+		sp.writeSize += int64(n)
+		if err != nil {
+			return
+		}
+	}
+
+	if sp.syncPolicy == OslSpoolSyncAlways {
+		err = sp.writeFile.Sync()
+	}
+	return
+}
+
+// Reads up to limit messages that follow the prior read, advancing the read position.
+// Lines that cannot be decoded are skipped and reported in err.
+//
+// The files are read without the lock, so that appends aren't held up; a line that is
+// being appended is not complete yet, and is read by a later call. Only one read, commit
+// or rewind may be in progress at a time.
+func (sp *openSearchSpool) read(limit int) (msgs []*OslMessage, err error) {
+	sp.mu.Lock()
+	writeFile := sp.writeFile
+	segments := slices.Clone(sp.segments)
+	readPos := sp.readPos
+	sp.mu.Unlock()
+
+	defer func() {
+		sp.mu.Lock()
+		sp.readPos = readPos
+		sp.mu.Unlock()
+	}()
+
+	if sp.syncPolicy == OslSpoolSyncBatch {
+		// a segment that was closed by an append has been synced already
+		if syncErr := writeFile.Sync(); syncErr != nil && !errors.Is(syncErr, os.ErrClosed) {
+			err = syncErr
+		}
+	}
+
+	writeSeg := segments[len(segments)-1]
+	for len(msgs) < limit {
+		// advance past the end of an older segment
+		if !slices.Contains(segments, readPos.Segment) {
+			idx, _ := slices.BinarySearch(segments, readPos.Segment)
+			if idx >= len(segments) {
+				return
+			}
+			readPos = spoolPosition{Segment: segments[idx]}
+		}
+
+		exhausted := true
+		scanErr := sp.scanSegment(readPos.Segment, readPos.Offset, func(line []byte) bool {
+			readPos.Offset += int64(len(line))
+
+			var msg OslMessage
+			if decodeErr := json.Unmarshal(line, &msg); decodeErr != nil {
+				err = errors.Join(err, decodeErr)
+			} else {
+				msgs = append(msgs, &msg)
+			}
+
+			if len(msgs) >= limit {
+				exhausted = false
+				return false
+			}
+			return true
+		})
+		if scanErr != nil {
+			err = errors.Join(err, scanErr)
+			return
+		}
+
+		if !exhausted || readPos.Segment == writeSeg {
+			return
+		}
+		readPos = spoolPosition{Segment: readPos.Segment + 1}
+	}
+	return
+}
+
+// Returns true if there are messages that have not been read.
+func (sp *openSearchSpool) hasUnread() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.readPos.Segment != sp.writeSegment() {
+		return true
+	}
+	return sp.readPos.Offset < sp.writeSize
+}
+
+// Acknowledges everything read so far, deleting segments no longer needed.
+func (sp *openSearchSpool) commit() (err error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.commitPos == sp.readPos {
+		return
+	}
+	sp.commitPos = sp.readPos
+
+	if err = sp.removeSegmentsBefore(sp.commitPos.Segment); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(sp.commitPos)
+	if err != nil {
+		return
+	}
+
+	path := filepath.Join(sp.dir, spoolCheckpointName)
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if err == nil && sp.syncPolicy != OslSpoolSyncNone {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Moves the read position back to the last commit, so that the uncommitted messages are read again.
+func (sp *openSearchSpool) rewind() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.readPos = sp.commitPos
+}
+
+func (sp *openSearchSpool) close() (err error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.writeFile == nil {
+		return
+	}
+
+	if sp.syncPolicy != OslSpoolSyncNone {
+		err = sp.writeFile.Sync()
+	}
+	err = errors.Join(err, sp.writeFile.Close())
+	sp.writeFile = nil
+
+	// don't leave an empty or fully acknowledged segment behind
+	writeSeg := sp.writeSegment()
+	if sp.writeSize == 0 || sp.commitPos == (spoolPosition{Segment: writeSeg, Offset: sp.writeSize}) {
+		err = errors.Join(err, os.Remove(sp.segmentPath(writeSeg)))
+		if len(sp.segments) == 1 {
+			if removeErr := os.Remove(filepath.Join(sp.dir, spoolCheckpointName)); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+				err = errors.Join(err, removeErr)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package osl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var ErrIncompleteClientCert = errors.New("a client certificate requires both a certificate file and a key file")
+var ErrInvalidCaBundle = errors.New("the CA bundle has no PEM certificates")
+var ErrTransportWithTls = errors.New("the TLS settings can't be combined with OpenSearchTransport")
+
+// Returns true if the config has any of the TLS settings.
+func hasTlsSettings(cfg *OslConfig) bool {
+	return cfg.TlsCertFile != "" || cfg.TlsKeyFile != "" || cfg.TlsCaFile != "" || cfg.TlsInsecureSkipVerify
+}
+
+// Makes a transport with the TLS settings of the config: the client certificate
+// and key for mutual TLS, and the CA bundle that verifies the server.
+func newTlsTransport(cfg *OslConfig) (transport *http.Transport, err error) {
+	tlsConfig := tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TlsInsecureSkipVerify, // #nosec G402 -- opt-in by config
+	}
+
+	if cfg.TlsCaFile != "" {
+		var pem []byte
+		if pem, err = os.ReadFile(cfg.TlsCaFile); err != nil {
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("%w: %s", ErrInvalidCaBundle, cfg.TlsCaFile)
+			return
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TlsCertFile != "" || cfg.TlsKeyFile != "" {
+		if cfg.TlsCertFile == "" || cfg.TlsKeyFile == "" {
+			err = ErrIncompleteClientCert
+			return
+		}
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(cfg.TlsCertFile, cfg.TlsKeyFile); err != nil {
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport = http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tlsConfig
+	return
+}
@@ -1,9 +1,12 @@
 package osl
 
 import (
+	"compress/gzip"
+	"context"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -125,3 +128,218 @@ func TestOslBulkInsertFail(t *testing.T) {
 
 	t.Fatal("didn't see message send failure")
 }
+
+func TestOslBulkInsertItemRejected(t *testing.T) {
+	// start the stub server
+	var wg sync.WaitGroup
+	stub := newStubServer(t, &wg)
+	defer stub.Close()
+
+	stub.BulkResponse = `{"took": 1, "errors": true, "items": [{"create": {"_index": "sample", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}]}`
+
+	protocol, host, port := stub.Connection()
+
+	// create an opensearch lane
+	cfg := OslConfig{
+		OpenSearchProtocol:  protocol,
+		OpenSearchHost:      host,
+		OpenSearchPort:      port,
+		OpenSearchTransport: stub.NewTransport(),
+		OpenSearchIndex:     "sample",
+		LogThreshold:        10,
+		MaxBufferSize:       10,
+		BackoffInterval:     time.Millisecond,
+		BackoffLimit:        time.Millisecond * 10,
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reason atomic.Value
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		reason.Store(logBuffer[0].RejectReason)
+	})
+
+	wg.Add(1)
+	osl.Info(500)
+
+	wg.Wait()
+
+	for range 40 {
+		stats := osl.Stats()
+		if stats.MessagesSentFailed == 1 {
+			if stats.MessagesSent != 0 {
+				t.Error("rejected message counted as sent")
+			}
+			if reason.Load() != "mapper_parsing_exception: failed to parse" {
+				t.Errorf("wrong reject reason: %v", reason.Load())
+			}
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatal("didn't see message rejected")
+}
+
+func TestOslBulkInsertCompressed(t *testing.T) {
+	// start the stub server
+	var wg sync.WaitGroup
+	stub := newStubServer(t, &wg)
+	defer stub.Close()
+
+	protocol, host, port := stub.Connection()
+
+	// create an opensearch lane
+	cfg := OslConfig{
+		OpenSearchProtocol:  protocol,
+		OpenSearchHost:      host,
+		OpenSearchPort:      port,
+		OpenSearchTransport: stub.NewTransport(),
+		OpenSearchIndex:     "sample",
+		LogThreshold:        10,
+		MaxBufferSize:       10,
+		BackoffInterval:     time.Millisecond,
+		BackoffLimit:        time.Millisecond * 10,
+		CompressRequests:    true,
+		CompressionLevel:    gzip.BestSpeed,
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Add(1)
+	osl.Info("compress me")
+
+	wg.Wait()
+
+	if stub.Compressed() != 1 {
+		t.Fatal("request was not compressed")
+	}
+
+	body := stub.LastBody()
+	if !strings.Contains(body, `"create":{"_index":"sample"}`) || !strings.Contains(body, `"message":"compress me"`) {
+		t.Fatalf("wrong body: %s", body)
+	}
+}
+
+func TestOslInvalidCompressionLevel(t *testing.T) {
+	cfg := OslConfig{
+		CompressRequests: true,
+		CompressionLevel: 10,
+	}
+	_, err := NewOpenSearchLane(nil, &cfg)
+	if err != ErrInvalidCompressionLevel {
+		t.Fatal("expected error")
+	}
+}
+
+func TestOslBulkInsertTooLarge(t *testing.T) {
+	// start the stub server
+	stub := newStubServer(t, nil)
+	defer stub.Close()
+
+	stub.MaxBodySize = 1500
+
+	protocol, host, port := stub.Connection()
+
+	// create an opensearch lane
+	cfg := OslConfig{
+		OpenSearchProtocol:  protocol,
+		OpenSearchHost:      host,
+		OpenSearchPort:      port,
+		OpenSearchTransport: stub.NewTransport(),
+		OpenSearchIndex:     "sample",
+		LogThreshold:        10,
+		MaxBufferSize:       10,
+		BackoffInterval:     time.Millisecond,
+		BackoffLimit:        time.Millisecond * 10,
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the batch of ten is too large, and is sent in smaller pieces
+	for i := range 10 {
+		osl.Infof("%d %s", i, strings.Repeat("x", 200))
+	}
+
+	for range 100 {
+		stats := osl.Stats()
+		if stats.MessagesSent == 10 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatal("didn't see messages sent")
+}
+
+func TestOslCredentialsRotation(t *testing.T) {
+	stub := newStubServer(t, nil)
+	defer stub.Close()
+
+	var mu sync.Mutex
+	secret := "first"
+	stub.RequireAuth = func(r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "admin" && pass == secret
+	}
+
+	// a vault client that caches the secret until told to refresh it
+	cached := ""
+	fetches := 0
+	credentials := func(ctx context.Context, refresh bool) (user, pass string, err error) {
+		if cached == "" || refresh {
+			mu.Lock()
+			cached = secret
+			mu.Unlock()
+			fetches++
+		}
+		return "admin", cached, nil
+	}
+
+	cfg := OslConfig{
+		OpenSearchAddresses: []string{stub.URL()},
+		OpenSearchTransport: &http.Transport{},
+		OpenSearchIndex:     "sample",
+		Credentials:         credentials,
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	emergencyCount := 0
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) { emergencyCount += len(logBuffer) })
+
+	osl.Info("before rotation")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	secret = "second"
+	mu.Unlock()
+
+	osl.Info("after rotation")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches != 2 {
+		t.Errorf("wrong number of fetches: %d", fetches)
+	}
+	if emergencyCount != 0 {
+		t.Error("the retry should not have needed the emergency handler")
+	}
+	if stats := osl.Stats(); stats.MessagesSent != 2 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
@@ -0,0 +1,170 @@
+package osl
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testVerifyLoadedConfig(t *testing.T, cfg *OslConfig) {
+	if cfg.OpenSearchHost != "opensearch.example.com" || cfg.OpenSearchPort != 9201 || cfg.OpenSearchIndex != "logging" {
+		t.Errorf("wrong connection settings: %+v", cfg)
+	}
+	if cfg.OpenSearchUser != "admin" || cfg.OpenSearchPass != "TheAdmin&1" {
+		t.Errorf("wrong credentials: %s %s", cfg.OpenSearchUser, cfg.OpenSearchPass)
+	}
+	if cfg.BackoffInterval != 5*time.Second || cfg.BackoffLimit != 90*time.Second || cfg.RequestTimeout != 0 {
+		t.Errorf("wrong durations: %v %v %v", cfg.BackoffInterval, cfg.BackoffLimit, cfg.RequestTimeout)
+	}
+	if cfg.MaxBufferSize != 500 || !cfg.CompressRequests {
+		t.Errorf("wrong buffering settings: %+v", cfg)
+	}
+	if cfg.OpenSearchTransport == nil || cfg.OpenSearchTransport.TLSClientConfig == nil || !cfg.OpenSearchTransport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("transport was not made from the TLS settings")
+	}
+}
+
+func TestLoadConfigJson(t *testing.T) {
+	dir := t.TempDir()
+	passFile := testWriteFile(t, dir, "pass", []byte("TheAdmin&1\n"))
+
+	path := testWriteFile(t, dir, "osl.json", []byte(`{
+	"openSearchHost": "opensearch.example.com",
+	"openSearchPort": 9201,
+	"openSearchUser": "admin",
+	"openSearchPassFile": "`+passFile+`",
+	"openSearchIndex": "logging",
+	"tlsInsecureSkipVerify": true,
+	"backoffInterval": "5s",
+	"backoffLimit": 90000000000,
+	"maxBufferSize": 500,
+	"compressRequests": true
+}`))
+
+	cfg, err := LoadOslConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testVerifyLoadedConfig(t, cfg)
+}
+
+func TestLoadConfigYaml(t *testing.T) {
+	dir := t.TempDir()
+	passFile := testWriteFile(t, dir, "pass", []byte("TheAdmin&1"))
+
+	path := testWriteFile(t, dir, "osl.yaml", []byte(`
+openSearchHost: opensearch.example.com
+openSearchPort: 9201
+openSearchUser: admin
+openSearchPassFile: `+passFile+`
+openSearchIndex: logging
+tlsInsecureSkipVerify: true
+backoffInterval: 5s
+backoffLimit: 1m30s
+maxBufferSize: 500
+compressRequests: true
+`))
+
+	cfg, err := LoadOslConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testVerifyLoadedConfig(t, cfg)
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	dir := t.TempDir()
+	passFile := testWriteFile(t, dir, "pass", []byte("TheAdmin&1"))
+
+	t.Setenv("OSL_OPENSEARCH_HOST", "opensearch.example.com")
+	t.Setenv("OSL_OPENSEARCH_PORT", "9201")
+	t.Setenv("OSL_OPENSEARCH_USER", "admin")
+	t.Setenv("OSL_OPENSEARCH_PASS_FILE", passFile)
+	t.Setenv("OSL_OPENSEARCH_INDEX", "logging")
+	t.Setenv("OSL_TLS_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("OSL_BACKOFF_INTERVAL", "5s")
+	t.Setenv("OSL_BACKOFF_LIMIT", "1m30s")
+	t.Setenv("OSL_MAX_BUFFER_SIZE", "500")
+	t.Setenv("OSL_COMPRESS_REQUESTS", "1")
+
+	cfg, err := LoadOslConfigFromEnv("OSL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testVerifyLoadedConfig(t, cfg)
+	if cfg.AwsSigV4 != nil {
+		t.Error("unexpected AWS settings")
+	}
+
+	t.Setenv("OSL_OPENSEARCH_ADDRESSES", "https://node1:9200, https://node2:9200")
+	t.Setenv("OSL_OPENSEARCH_USER", "")
+	t.Setenv("OSL_OPENSEARCH_PASS_FILE", "")
+	t.Setenv("OSL_AWS_SIGV4_REGION", "us-west-2")
+	t.Setenv("OSL_AWS_SIGV4_SERVICE", "aoss")
+	t.Setenv("OSL_OVERFLOW_POLICY", "block")
+	t.Setenv("OSL_OVERFLOW_TIMEOUT", "2s")
+	t.Setenv("OSL_EVICTION_ORDER", "DEBUG, INFO")
+	t.Setenv("OSL_ROUTES", `[{"index": "alerts", "minLevel": "ERROR"}]`)
+	t.Setenv("OSL_DATA_STREAM", "true")
+	if cfg, err = LoadOslConfigFromEnv("OSL_"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OverflowPolicy != OslOverflowBlock || cfg.OverflowTimeout != 2*time.Second {
+		t.Errorf("wrong overflow settings: %s %v", cfg.OverflowPolicy, cfg.OverflowTimeout)
+	}
+	if !slices.Equal(cfg.EvictionOrder, []string{"DEBUG", "INFO"}) {
+		t.Errorf("wrong eviction order: %v", cfg.EvictionOrder)
+	}
+	if len(cfg.Routes) != 1 || cfg.Routes[0].Index != "alerts" || cfg.Routes[0].MinLevel != "ERROR" {
+		t.Errorf("wrong routes: %+v", cfg.Routes)
+	}
+	if !cfg.DataStream || cfg.DataStreamTemplate {
+		t.Errorf("wrong data stream settings: %v %v", cfg.DataStream, cfg.DataStreamTemplate)
+	}
+	if len(cfg.OpenSearchAddresses) != 2 || cfg.OpenSearchAddresses[1] != "https://node2:9200" {
+		t.Errorf("wrong addresses: %v", cfg.OpenSearchAddresses)
+	}
+	if cfg.AwsSigV4 == nil || cfg.AwsSigV4.Region != "us-west-2" || cfg.AwsSigV4.Service != OslAwsServiceServerless {
+		t.Errorf("wrong AWS settings: %+v", cfg.AwsSigV4)
+	}
+
+	t.Setenv("OSL_BACKOFF_LIMIT", "soon")
+	if _, err = LoadOslConfigFromEnv("OSL"); err == nil || !strings.Contains(err.Error(), "OSL_BACKOFF_LIMIT") {
+		t.Errorf("expected duration error: %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		errText string
+	}{
+		{"unknown.json", `{"openSearchHots": "localhost"}`, "unknown field"},
+		{"duration.yml", "backoffLimit: forever", "invalid duration"},
+		{"secret.json", `{"openSearchPass": "a", "openSearchPassFile": "/run/secrets/pass"}`, ErrConflictingSecret.Error()},
+		{"invalid.json", `{"openSearchHost": "localhost", "openSearchIndex": "logging", "spoolDir": "/tmp", "spoolSync": "sometimes"}`, ErrInvalidSpoolSync.Error()},
+	}
+
+	for _, test := range tests {
+		_, err := LoadOslConfigFromFile(testWriteFile(t, dir, test.name, []byte(test.content)))
+		if err == nil || !strings.Contains(err.Error(), test.errText) {
+			t.Errorf("%s: expected %q: %v", test.name, test.errText, err)
+		}
+	}
+
+	_, err := LoadOslConfigFromFile(filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Error("expected missing file error")
+	}
+
+	_, err = LoadOslConfigFromFile(testWriteFile(t, dir, "secret.yaml", []byte("openSearchHost: localhost\nopenSearchIndex: logging\nopenSearchPassFile: "+filepath.Join(dir, "nope"))))
+	if err == nil || errors.Is(err, ErrConflictingSecret) {
+		t.Errorf("expected missing secret file error: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package osl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/v3/opensearchapi"
+)
+
+func testMakeDataStreamOsl(t *testing.T, bootstrap bool) (tc *testClient, osl OpenSearchLane) {
+	tc, osl = testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.DataStream = true
+	cfg.DataStreamTemplate = bootstrap
+	cfg.FlushLevel = "FATAL" // one batch
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestDataStreamDocument(t *testing.T) {
+	_, osl := testMakeDataStreamOsl(t, false)
+	osc := osl.(*openSearchLane).openSearchConnection
+
+	msgs := []*OslMessage{
+		{Message: "dated", Metadata: map[string]string{"timestamp": "2024-12-31T23:59:59Z"}},
+		{Message: "undated"},
+	}
+	jsonData, err := osc.generateBulkJson(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(jsonData), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("wrong bulk request: %s", jsonData)
+	}
+
+	var create map[string]map[string]string
+	if err = json.Unmarshal([]byte(lines[0]), &create); err != nil {
+		t.Fatal(err)
+	}
+	if create["create"]["_index"] != "testing" {
+		t.Errorf("wrong action: %s", lines[0])
+	}
+
+	var dated, undated map[string]any
+	if err = json.Unmarshal([]byte(lines[1]), &dated); err != nil {
+		t.Fatal(err)
+	}
+	if dated["@timestamp"] != "2024-12-31T23:59:59Z" || dated["message"] != "dated" {
+		t.Errorf("wrong document: %s", lines[1])
+	}
+
+	if err = json.Unmarshal([]byte(lines[3]), &undated); err != nil {
+		t.Fatal(err)
+	}
+	stamp, _ := undated["@timestamp"].(string)
+	if ts, err := time.Parse(time.RFC3339Nano, stamp); err != nil || time.Since(ts) > time.Minute {
+		t.Errorf("wrong timestamp: %s", lines[3])
+	}
+	osl.Close()
+}
+
+func TestDataStream(t *testing.T) {
+	tc, osl := testMakeDataStreamOsl(t, false)
+	tc.dataStreams = []string{"testing"}
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.Routes = []OslRoute{{Index: "alerts", MinLevel: "ERROR"}}
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var rejected []*OslMessage
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				rejected = append(rejected, msg)
+			}
+		}
+	})
+
+	osl.Info("stream")
+	osl.Error("not a stream")
+	osl.Info("stream again")
+	if err := osl.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), ErrNotDataStream.Error()) {
+		t.Errorf("expected not a data stream error: %v", err)
+	}
+
+	if !slices.Equal(tc.indicies, []string{"testing", "testing"}) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+	if len(rejected) != 1 || rejected[0].Message != "not a stream" || !strings.Contains(rejected[0].RejectReason, "alerts") {
+		t.Errorf("wrong rejected messages: %+v", rejected)
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesSent != 2 || stats.MessagesRejected != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	osl.Close()
+}
+
+func TestDataStreamIndex(t *testing.T) {
+	tc, osl := testMakeDataStreamOsl(t, false)
+
+	// a name that exists as something other than a data stream
+	tc.dataStreams = []string{"testing"}
+	osc := osl.(*openSearchLane).openSearchConnection
+	if err := osc.ensureDataStream(&notListedClient{tc}, "testing"); err == nil || !strings.Contains(err.Error(), ErrNotDataStream.Error()) {
+		t.Errorf("expected not a data stream error: %v", err)
+	}
+
+	// a failure of the cluster is not a rejection
+	tc.failure = opensearchapi.Error{Status: http.StatusServiceUnavailable}
+	osl.Info("deferred")
+	if err := osl.Flush(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+	if stats := osl.Stats(); stats.MessagesRejected != 0 || stats.BatchRetries != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	tc.failure = nil
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 1 {
+		t.Errorf("expected the message to be sent after the retry, got %d", tc.count.Load())
+	}
+	osl.Close()
+}
+
+func TestDataStreamTemplate(t *testing.T) {
+	tc, osl := testMakeDataStreamOsl(t, true)
+
+	// a matching template of the cluster is used as is
+	tc.templates = []string{"audit-*"}
+	audit, err := osl.DeriveWithOverrides(OslLaneOverrides{Index: "audit-events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	osl.Info("bootstrapped")
+	audit.Info("templated")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tc.templates, []string{"audit-*", "testing"}) {
+		t.Errorf("wrong templates: %v", tc.templates)
+	}
+	if !slices.Equal(tc.dataStreams, []string{"testing", "audit-events"}) {
+		t.Errorf("wrong data streams: %v", tc.dataStreams)
+	}
+	if !slices.Equal(tc.indicies, []string{"testing", "audit-events"}) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+
+	// the data streams are not checked again
+	tc.dataStreams = nil
+	osl.Info("checked")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.dataStreams) != 0 || tc.count.Load() != 3 {
+		t.Errorf("unexpected data stream check: %v, %d sent", tc.dataStreams, tc.count.Load())
+	}
+	osl.Close()
+}
+
+type notListedClient struct {
+	*testClient
+}
+
+func (c *notListedClient) DataStreamGet(ctx context.Context, req *opensearchapi.DataStreamGetReq) (*opensearchapi.DataStreamGetResp, error) {
+	return &opensearchapi.DataStreamGetResp{}, nil
+}
@@ -0,0 +1,238 @@
+package osl
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEmergencyFiles(t *testing.T, dir string) (files []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), emergencyFilePrefix) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return
+}
+
+func TestEmergencyFileHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	ef, err := NewEmergencyFileHandler(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, osl := testMakeFirstOslEx(t, testNoTees|testMax10|testOffline|testNoIndex)
+	osl.SetEmergencyHandler(ef)
+
+	for i := range 11 {
+		osl.Infof("message %d", i)
+	}
+	osl.Close()
+
+	files := testEmergencyFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("wrong file count: %d", len(files))
+	}
+
+	messages, err := ReadEmergencyFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 12 {
+		t.Fatalf("wrong message count: %d", len(messages))
+	}
+
+	// the first message is evicted for lack of room, and reported
+	if messages[1].AppName != "OpenSearchLane" || !strings.Contains(messages[1].Message, "evicted 1 INFO") {
+		t.Errorf("wrong overflow report: %+v", messages[1])
+	}
+	messages = append(messages[:1], messages[2:]...)
+
+	for i, msg := range messages {
+		if msg.Message != fmt.Sprintf("message %d", i) || msg.Level != "INFO" {
+			t.Errorf("wrong message %d: %+v", i, msg)
+		}
+	}
+}
+
+func TestEmergencyFileRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	ef, err := NewEmergencyFileHandler(dir, 100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 10 {
+		ef([]*OslMessage{{AppName: "test", Message: fmt.Sprintf("message %d", i)}})
+	}
+
+	files := testEmergencyFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("wrong file count: %d", len(files))
+	}
+
+	// the newest messages are kept
+	messages, err := ReadEmergencyFile(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Message != "message 9" {
+		t.Fatal("newest message not in the newest file")
+	}
+
+	// a new handler continues with the existing files
+	ef, err = NewEmergencyFileHandler(dir, 100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ef([]*OslMessage{{AppName: "test", Message: "message 10"}})
+
+	files2 := testEmergencyFiles(t, dir)
+	if len(files2) != 3 {
+		t.Fatalf("wrong file count after restart: %d", len(files2))
+	}
+	messages, err = ReadEmergencyFile(files2[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages[len(messages)-1].Message != "message 10" {
+		t.Fatal("newest message not in the newest file after restart")
+	}
+}
+
+func TestReadEmergencyFileDamaged(t *testing.T) {
+	dir := t.TempDir()
+
+	// a crash cut the last write short, and a restart appended to a partial line
+	data := `{"appName":"test","message":"message 0"}
+{"appName":"test","mess{"appName":"test","message":"message 1"}
+{"appName":"test","message":"message 2"}
+{"appName":"test","mess`
+	path := testWriteFile(t, dir, "emergency", []byte(data))
+
+	messages, err := ReadEmergencyFile(path)
+	if err == nil || !strings.Contains(err.Error(), "line 2") || strings.Contains(err.Error(), "line 4") {
+		t.Errorf("expected an error for line 2 only: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Message != "message 0" || messages[1].Message != "message 2" {
+		t.Errorf("wrong messages: %+v", messages)
+	}
+
+	// a trailing line without a terminator is kept if it is whole
+	path = testWriteFile(t, dir, "whole", []byte(`{"appName":"test","message":"message 0"}`))
+	if messages, err = ReadEmergencyFile(path); err != nil || len(messages) != 1 {
+		t.Errorf("wrong messages: %+v %v", messages, err)
+	}
+}
+
+func TestReplayMessages(t *testing.T) {
+	tc := &testClient{}
+	tc.install(t)
+
+	messages := []*OslMessage{}
+	for i := range 25 {
+		messages = append(messages, &OslMessage{
+			AppName:    "replay",
+			LogMessage: fmt.Sprintf("INFO {abc} message %d", i),
+			Message:    fmt.Sprintf("message %d", i),
+		})
+	}
+	messages[3].RejectReason = "earlier failure"
+
+	cfg := OslConfig{
+		OpenSearchHost:      "localhost",
+		OpenSearchPort:      1000,
+		OpenSearchIndex:     "testing",
+		OpenSearchTransport: &http.Transport{},
+		MaxBufferSize:       10,
+	}
+
+	stats, err := ReplayMessages(&cfg, messages, func(baseName string) string { return baseName + "-replay" }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.MessagesQueued != 25 || stats.MessagesSent != 25 || stats.MessagesSentFailed != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	if len(tc.lines) != 25 || tc.lines[24].Message != "message 24" {
+		t.Fatal("messages were not uploaded")
+	}
+	if tc.lines[3].RejectReason != "" {
+		t.Error("reject reason was uploaded")
+	}
+	for _, index := range tc.indicies {
+		if index != "testing-replay" {
+			t.Fatalf("wrong index: %s", index)
+		}
+	}
+}
+
+func TestReplayMessagesSharded(t *testing.T) {
+	tc := &testClient{}
+	tc.install(t)
+
+	messages := []*OslMessage{
+		{AppName: "replay", Message: "before", Metadata: map[string]string{"timestamp": "2024-12-31T23:59:59Z"}},
+		{AppName: "replay", Message: "after", Metadata: map[string]string{"timestamp": "2025-01-01T00:00:01Z"}},
+	}
+
+	cfg := OslConfig{
+		OpenSearchHost:      "localhost",
+		OpenSearchPort:      1000,
+		OpenSearchIndex:     "testing",
+		OpenSearchTransport: &http.Transport{},
+	}
+
+	sharderFn := func(baseName string, msg *OslMessage) string {
+		return baseName + "-" + msg.Timestamp().Format(time.DateOnly)
+	}
+	if _, err := ReplayMessagesSharded(&cfg, messages, sharderFn, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tc.indicies, []string{"testing-2024-12-31", "testing-2025-01-01"}) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+}
+
+func TestReplayMessagesFailure(t *testing.T) {
+	tc := &testClient{}
+	tc.install(t)
+	tc.failure = os.ErrPermission
+
+	cfg := OslConfig{
+		OpenSearchHost:      "localhost",
+		OpenSearchPort:      1000,
+		OpenSearchIndex:     "testing",
+		OpenSearchTransport: &http.Transport{},
+		BackoffInterval:     time.Millisecond,
+		BackoffLimit:        time.Millisecond * 4,
+	}
+
+	messages := []*OslMessage{{AppName: "replay", Message: "message"}}
+	stats, err := ReplayMessages(&cfg, messages, nil, nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if stats.MessagesSent != 0 || stats.MessagesSentFailed != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	if _, err = ReplayMessages(nil, messages, nil, nil); err != ErrReplayOffline {
+		t.Error("expected offline error")
+	}
+}
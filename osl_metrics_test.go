@@ -0,0 +1,42 @@
+package osl
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestObserveRequests(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	var first, second []error
+	stopFirst := osl.ObserveRequests(func(duration time.Duration, err error) {
+		first = append(first, err)
+	})
+	stopSecond := osl.ObserveRequests(func(duration time.Duration, err error) {
+		second = append(second, err)
+	})
+
+	osl.Info("observed")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || first[0] != nil || len(second) != 1 {
+		t.Fatalf("the request was not observed by both: %v, %v", first, second)
+	}
+
+	// an observer keeps observing after another is removed
+	stopFirst()
+	tc.failure = os.ErrPermission
+	osl.Info("failed")
+	if err := osl.Flush(context.Background()); err == nil {
+		t.Fatal("expected failure")
+	}
+	if len(first) != 1 || len(second) != 2 || second[1] == nil {
+		t.Errorf("wrong observations: %v, %v", first, second)
+	}
+
+	stopSecond()
+	stopSecond()
+}
@@ -0,0 +1,131 @@
+package osl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/v3/opensearchapi"
+)
+
+func TestOslRoundRobin(t *testing.T) {
+	stub1 := newStubServer(t, nil)
+	defer stub1.Close()
+	stub2 := newStubServer(t, nil)
+	defer stub2.Close()
+
+	cfg := OslConfig{
+		OpenSearchAddresses: []string{stub1.URL(), stub2.URL()},
+		OpenSearchTransport: &http.Transport{},
+		OpenSearchIndex:     "sample",
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	for i := range 4 {
+		osl.Info(i)
+		if err = osl.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := osl.Stats()
+	if len(stats.Nodes) != 2 {
+		t.Fatalf("wrong node stats: %+v", stats.Nodes)
+	}
+	for i, node := range stats.Nodes {
+		if node.Address != cfg.OpenSearchAddresses[i] || node.Requests != 2 || node.Failures != 0 || node.Dead {
+			t.Errorf("wrong node stats: %+v", node)
+		}
+	}
+}
+
+func TestOslDeadNode(t *testing.T) {
+	dead := newStubServer(t, nil)
+	deadURL := dead.URL()
+	dead.Close()
+
+	live := newStubServer(t, nil)
+	defer live.Close()
+
+	cfg := OslConfig{
+		OpenSearchAddresses: []string{deadURL, live.URL()},
+		OpenSearchTransport: &http.Transport{},
+		OpenSearchIndex:     "sample",
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	for i := range 3 {
+		osl.Info(i)
+		if err = osl.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesSent != 3 {
+		t.Errorf("messages were not sent: %+v", stats)
+	}
+	if !stats.Nodes[0].Dead || stats.Nodes[0].Failures != 1 {
+		t.Errorf("first node should be dead: %+v", stats.Nodes[0])
+	}
+	if stats.Nodes[1].Dead || stats.Nodes[1].Requests != 3 {
+		t.Errorf("second node should serve every request: %+v", stats.Nodes[1])
+	}
+}
+
+func TestOslNodeResurrection(t *testing.T) {
+	tc1 := &testClient{lines: []*OslMessage{}, failure: os.ErrDeadlineExceeded}
+	tc2 := &testClient{lines: []*OslMessage{}}
+
+	np := openSearchNodePool{
+		nodes: []*openSearchNode{
+			{address: "node1", client: tc1},
+			{address: "node2", client: tc2},
+		},
+		cooldown: time.Millisecond * 50,
+	}
+
+	req := func() {
+		_, err := np.Bulk(context.Background(), opensearchapi.BulkReq{Body: strings.NewReader(`{"create":{"_index":"test"}}` + "\n" + `{"message":"test"}` + "\n")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req()
+	req()
+	if stats := np.stats(); !stats[0].Dead || stats[0].Requests != 1 || stats[1].Requests != 2 {
+		t.Fatalf("first node should be dead: %+v", stats)
+	}
+
+	tc1.failure = nil
+	time.Sleep(time.Millisecond * 60)
+	req()
+	if stats := np.stats(); stats[0].Dead || stats[0].Requests != 2 {
+		t.Fatalf("first node should be resurrected: %+v", stats)
+	}
+}
+
+func TestOslInvalidAddress(t *testing.T) {
+	cfg := OslConfig{
+		OpenSearchAddresses: []string{"localhost:9200"},
+		OpenSearchTransport: &http.Transport{},
+		OpenSearchIndex:     "sample",
+	}
+	_, err := NewOpenSearchLane(nil, &cfg)
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("expected invalid address: %v", err)
+	}
+}
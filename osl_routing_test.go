@@ -0,0 +1,165 @@
+package osl
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRouting(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.Routes = []OslRoute{
+		{Index: "alerts", MinLevel: "error"},
+		{Index: "tenant-x", Metadata: map[string]string{"tenant": "x"}},
+	}
+	cfg.FlushLevel = "FATAL" // one batch
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	tc.itemStatusFn = func(msg *OslMessage) int {
+		if msg.Message == "reject" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}
+
+	osl.Info("default")
+	osl.Error("alert")
+	osl.SetMetadata("tenant", "x")
+	osl.Info("tenant")
+	osl.Error("first route wins")
+	osl.SetMetadata("tenant", "y")
+	osl.Info("reject")
+
+	if err := osl.Flush(context.Background()); err == nil {
+		t.Fatal("expected rejection error")
+	}
+
+	expected := []string{"testing", "alerts", "tenant-x", "alerts", "testing"}
+	if !slices.Equal(tc.indicies, expected) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+
+	indices := osl.Stats().Indices
+	expectedStats := map[string]OslIndexStats{
+		"testing":  {Sent: 1, Rejected: 1},
+		"alerts":   {Sent: 2},
+		"tenant-x": {Sent: 1},
+	}
+	if !maps.Equal(indices, expectedStats) {
+		t.Errorf("wrong index stats: %v", indices)
+	}
+	osl.Close()
+}
+
+func TestRoutingSharded(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.Routes = []OslRoute{{Index: "alerts", MinLevel: "WARN"}}
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// the routed index is decorated the same as the default index
+	osl.SetIndexSharder(func(baseName string) string { return baseName + "-123" })
+
+	osl.Info("default")
+	osl.Warn("alert")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tc.indicies, []string{"testing-123", "alerts-123"}) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+	osl.Close()
+}
+
+func TestRouteStack(t *testing.T) {
+	// stack traces rank above FATAL
+	route := OslRoute{Index: "alerts", MinLevel: "ERROR"}
+	if !route.matches(&OslMessage{Level: "STACK"}) {
+		t.Error("a stack trace line should match")
+	}
+	route.MinLevel = "STACK"
+	if route.matches(&OslMessage{Level: "FATAL"}) || !route.matches(&OslMessage{Level: "STACK"}) {
+		t.Error("only stack trace lines should match")
+	}
+}
+
+func TestRouteInvalid(t *testing.T) {
+	routes := [][]OslRoute{
+		{{Index: ""}},
+		{{Index: "Alerts"}},
+		{{Index: "alerts", MinLevel: "severe"}},
+	}
+
+	for _, route := range routes {
+		cfg := OslConfig{Routes: route}
+		if _, err := NewOpenSearchLane(context.Background(), &cfg); !errors.Is(err, ErrInvalidRoute) {
+			t.Errorf("%+v: expected invalid route error: %v", route, err)
+		}
+	}
+}
+
+func TestDeriveWithOverrides(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+
+	audit, err := osl.DeriveWithOverrides(OslLaneOverrides{Index: "audit", AppName: "auditor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := audit.DeriveWithOverrides(OslLaneOverrides{AppName: "reviewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	osl.Info("default")
+	audit.Info("audit")
+	renamed.Info("inherited index")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tc.indicies, []string{"testing", "audit", "audit"}) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+	var appNames []string
+	for _, msg := range tc.lines {
+		appNames = append(appNames, msg.AppName)
+		if msg.Index != "" {
+			t.Errorf("the index override was uploaded: %+v", msg)
+		}
+	}
+	if !slices.Equal(appNames, []string{"", "auditor", "reviewer"}) {
+		t.Errorf("wrong app names: %v", appNames)
+	}
+
+	if _, err = osl.DeriveWithOverrides(OslLaneOverrides{Index: "Audit"}); !errors.Is(err, ErrInvalidIndexName) {
+		t.Errorf("expected invalid index name error: %v", err)
+	}
+
+	// the derived lanes share the connection
+	renamed.Close()
+	audit.Close()
+	osl.Info("still open")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	osl.Close()
+}
@@ -0,0 +1,107 @@
+package osl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testShardMessage(timestamp string) *OslMessage {
+	return &OslMessage{Metadata: map[string]string{"timestamp": timestamp}}
+}
+
+func TestTimeSharder(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	tests := []struct {
+		period    OslShardPeriod
+		location  *time.Location
+		layout    string
+		timestamp string
+		index     string
+	}{
+		{OslShardHourly, nil, "", "2024-12-31T23:59:59Z", "logging-2024-12-31-23"},
+		{OslShardDaily, nil, "", "2024-12-31T23:59:59Z", "logging-2024-12-31"},
+		{OslShardDaily, newYork, "", "2025-01-01T03:00:00Z", "logging-2024-12-31"},
+		{OslShardWeekly, nil, "", "2025-01-01T12:00:00Z", "logging-2024-12-30"},
+		{OslShardWeekly, nil, "", "2024-12-29T12:00:00Z", "logging-2024-12-23"},
+		{OslShardWeekly, nil, "", "2024-12-30T00:00:00Z", "logging-2024-12-30"},
+		{OslShardMonthly, nil, "", "2024-12-31T23:59:59Z", "logging-2024-12"},
+		{OslShardMonthly, newYork, "", "2025-01-01T03:00:00Z", "logging-2024-12"},
+		{OslShardDaily, nil, "2006.01.02", "2024-12-31T23:59:59Z", "logging-2024.12.31"},
+	}
+
+	for _, test := range tests {
+		sharderFn, err := NewTimeSharder(test.period, test.location, test.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index := sharderFn("logging", testShardMessage(test.timestamp)); index != test.index {
+			t.Errorf("%s %s: expected %s, got %s", test.period, test.timestamp, test.index, index)
+		}
+	}
+}
+
+func TestTimeSharderNoTimestamp(t *testing.T) {
+	sharderFn, err := NewTimeSharder(OslShardMonthly, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "logging-" + time.Now().UTC().Format("2006-01")
+	if index := sharderFn("logging", &OslMessage{}); index != expected {
+		t.Errorf("expected %s, got %s", expected, index)
+	}
+}
+
+func TestTimeSharderErrors(t *testing.T) {
+	if _, err := NewTimeSharder("yearly", nil, ""); !errors.Is(err, ErrInvalidShardPeriod) {
+		t.Errorf("expected invalid period error: %v", err)
+	}
+	for _, layout := range []string{"Jan-2006", "2006/01/02", "15:04", "2006 01 02"} {
+		if _, err := NewTimeSharder(OslShardDaily, nil, layout); !errors.Is(err, ErrInvalidIndexName) {
+			t.Errorf("expected invalid index name error for %s: %v", layout, err)
+		}
+	}
+}
+
+func TestValidateIndexName(t *testing.T) {
+	for _, name := range []string{"logging", "logging-2024.12.31", "app_logs+1"} {
+		if err := ValidateIndexName(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	long := strings.Repeat("a", maxIndexNameLength+1)
+	for _, name := range []string{"", ".", "..", "Logging", "_logs", "-logs", "+logs", "a b", "a,b", "a#b", "a:b", "a*b", long} {
+		if err := ValidateIndexName(name); !errors.Is(err, ErrInvalidIndexName) {
+			t.Errorf("%s: expected invalid index name error: %v", name, err)
+		}
+	}
+}
+
+func TestTimeSharderLane(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	sharderFn, err := NewTimeSharder(OslShardDaily, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	osl.SetMessageSharder(sharderFn)
+
+	osl.Info("daily")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "testing-" + time.Now().UTC().Format(time.DateOnly)
+	if len(tc.indicies) != 1 || tc.indicies[0] != expected {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+	osl.Close()
+}
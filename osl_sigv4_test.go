@@ -0,0 +1,153 @@
+package osl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSigV4TestSuite(t *testing.T) {
+	// vectors from the AWS Signature Version 4 test suite
+	tests := []struct {
+		url       string
+		signature string
+	}{
+		{"https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+
+	s := sigV4Signer{region: "us-east-1", service: "service"}
+	creds := OslAwsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	when := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s.sign(req, creds, hexSha256(nil), when)
+
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + test.signature
+		if req.Header.Get("Authorization") != expected {
+			t.Errorf("wrong signature for %s: %s", test.url, req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestOslSigV4(t *testing.T) {
+	stub := newStubServer(t, nil)
+	defer stub.Close()
+
+	for _, service := range []string{OslAwsServiceOpenSearch, OslAwsServiceServerless} {
+		cfg := OslConfig{
+			OpenSearchAddresses: []string{stub.URL()},
+			OpenSearchTransport: &http.Transport{},
+			OpenSearchIndex:     "sample",
+			AwsSigV4: &OslAwsSigV4{
+				Region:      "us-west-2",
+				Service:     service,
+				Credentials: StaticAwsCredentials("AKID", "SECRET", "TOKEN"),
+			},
+		}
+		osl, err := NewOpenSearchLane(nil, &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		osl.Info("signed")
+		if err = osl.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		osl.Close()
+
+		header := stub.LastHeader()
+		pattern := regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=AKID/\d{8}/us-west-2/` + service + `/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature=[0-9a-f]{64}$`)
+		if !pattern.MatchString(header.Get("Authorization")) {
+			t.Errorf("wrong authorization header: %s", header.Get("Authorization"))
+		}
+
+		sum := sha256.Sum256([]byte(stub.LastBody()))
+		if header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			t.Error("wrong payload hash")
+		}
+		if header.Get("X-Amz-Security-Token") != "TOKEN" {
+			t.Error("missing session token")
+		}
+		if _, err = time.Parse(sigV4TimeFormat, header.Get("X-Amz-Date")); err != nil {
+			t.Errorf("wrong date header: %v", err)
+		}
+	}
+}
+
+func TestOslSigV4Credentials(t *testing.T) {
+	stub := newStubServer(t, nil)
+	defer stub.Close()
+	stub2 := newStubServer(t, nil)
+	defer stub2.Close()
+
+	calls := 0
+	cfg := OslConfig{
+		OpenSearchAddresses: []string{stub.URL(), stub2.URL()},
+		OpenSearchTransport: &http.Transport{},
+		OpenSearchIndex:     "sample",
+		AwsSigV4: &OslAwsSigV4{
+			Region: "us-west-2",
+			Credentials: func(ctx context.Context) (creds OslAwsCredentials, err error) {
+				calls++
+				err = ErrAwsCredentialsRequired
+				return
+			},
+		},
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	osl.Info("unsigned")
+	if err = osl.Flush(context.Background()); !errors.Is(err, ErrAwsCredentialsRequired) {
+		t.Fatalf("expected credentials error: %v", err)
+	}
+
+	// a request that can't be signed is not the fault of the node
+	if calls != 1 {
+		t.Errorf("credentials requested %d times", calls)
+	}
+	for _, node := range osl.Stats().Nodes {
+		if node.Failures != 0 || node.Dead {
+			t.Errorf("wrong node stats: %+v", node)
+		}
+	}
+}
+
+func TestOslSigV4Config(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	cfg := OslConfig{AwsSigV4: &OslAwsSigV4{}}
+	if _, err := NewOpenSearchLane(nil, &cfg); err != ErrAwsRegionRequired {
+		t.Errorf("expected region error: %v", err)
+	}
+
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	cfg.AwsSigV4.Service = "s3"
+	if _, err := NewOpenSearchLane(nil, &cfg); err != ErrInvalidAwsService {
+		t.Errorf("expected service error: %v", err)
+	}
+
+	cfg.AwsSigV4.Service = ""
+	sigV4, err := sanitizeSigV4(*cfg.AwsSigV4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigV4.Region != "eu-west-1" || sigV4.Service != OslAwsServiceOpenSearch || sigV4.Credentials == nil {
+		t.Errorf("wrong defaults: %+v", sigV4)
+	}
+}
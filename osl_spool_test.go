@@ -0,0 +1,310 @@
+package osl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSpoolSegmentCount(t *testing.T, dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), spoolSegmentExt) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSpoolReadCommitRewind(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, recovered, err := openSpool(dir, OslSpoolSyncBatch, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered != 0 {
+		t.Fatalf("unexpected recovered messages: %d", recovered)
+	}
+
+	for i := range 10 {
+		if err = sp.append(&OslMessage{Message: fmt.Sprintf("message %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if testSpoolSegmentCount(t, dir) < 2 {
+		t.Fatal("expected multiple segments")
+	}
+
+	msgs, err := sp.read(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].Message != "message 0" || msgs[2].Message != "message 2" {
+		t.Fatal("wrong first batch")
+	}
+	if err = sp.commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err = sp.read(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].Message != "message 3" {
+		t.Fatal("wrong second batch")
+	}
+
+	sp.rewind()
+	msgs, err = sp.read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 7 || msgs[0].Message != "message 3" || msgs[6].Message != "message 9" {
+		t.Fatal("wrong rewound batch")
+	}
+	if sp.hasUnread() {
+		t.Fatal("spool should be fully read")
+	}
+	if err = sp.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if testSpoolSegmentCount(t, dir) != 1 {
+		t.Fatal("consumed segments were not removed")
+	}
+
+	if err = sp.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolReadWhileAppending(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, _, err := openSpool(dir, OslSpoolSyncBatch, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.close()
+
+	// the reads don't block the appends, which rotate segments and leave partial lines
+	count := 500
+	appendErr := make(chan error, 1)
+	go func() {
+		for i := range count {
+			if err := sp.append(&OslMessage{Message: fmt.Sprintf("message %d", i)}); err != nil {
+				appendErr <- err
+				return
+			}
+		}
+		appendErr <- nil
+	}()
+
+	next := 0
+	deadline := time.Now().Add(time.Second * 10)
+	for next < count && time.Now().Before(deadline) {
+		msgs, err := sp.read(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range msgs {
+			if msg.Message != fmt.Sprintf("message %d", next) {
+				t.Fatalf("expected message %d, got %q", next, msg.Message)
+			}
+			next++
+		}
+		if err = sp.commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = <-appendErr; err != nil {
+		t.Fatal(err)
+	}
+	if next != count {
+		t.Fatalf("read %d of %d messages", next, count)
+	}
+	if sp.hasUnread() {
+		t.Fatal("spool should be fully read")
+	}
+}
+
+func TestSpoolReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, _, err := openSpool(dir, OslSpoolSyncAlways, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 10 {
+		if err = sp.append(&OslMessage{Message: fmt.Sprintf("message %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = sp.read(4); err != nil {
+		t.Fatal(err)
+	}
+	if err = sp.commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// read but not acknowledged
+	if _, err = sp.read(4); err != nil {
+		t.Fatal(err)
+	}
+	if err = sp.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash in the middle of writing a line
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d%s", 99, spoolSegmentExt)), os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"message":"partial`)
+	f.Close()
+
+	sp, recovered, err := openSpool(dir, OslSpoolSyncAlways, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered != 6 {
+		t.Fatalf("wrong recovered count: %d", recovered)
+	}
+
+	msgs, err := sp.read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 6 || msgs[0].Message != "message 4" {
+		t.Fatal("wrong recovered messages")
+	}
+
+	if err = sp.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolUploadAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// log while offline, then exit
+	osl, err := NewOpenSearchLane(context.Background(), &OslConfig{SpoolDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emergencyCount := 0
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) { emergencyCount += len(logBuffer) })
+
+	for i := range 5 {
+		osl.Infof("offline %d", i)
+	}
+	osl.Close()
+
+	if emergencyCount != 0 {
+		t.Fatal("spooled messages should not go to the emergency handler")
+	}
+
+	// start again, this time connected
+	tc := &testClient{}
+	tc.install(t)
+
+	cfg := OslConfig{
+		OpenSearchHost:      "localhost",
+		OpenSearchPort:      1000,
+		OpenSearchIndex:     "testing",
+		OpenSearchTransport: &http.Transport{},
+		SpoolDir:            dir,
+	}
+	osl, err = NewOpenSearchLane(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	osl.Info("online")
+	osl.Close()
+
+	expected := `INFO	offline 0
+INFO	offline 1
+INFO	offline 2
+INFO	offline 3
+INFO	offline 4
+INFO	online`
+
+	if !tc.VerifyReceived(expected) {
+		t.Errorf("Test events don't match")
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesQueued != 6 || stats.MessagesSent != 6 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	if testSpoolSegmentCount(t, dir) != 0 {
+		t.Error("spool was not emptied")
+	}
+}
+
+func TestSpoolBulkErrorRetained(t *testing.T) {
+	dir := t.TempDir()
+
+	tc, osl := testMakeFirstOslEx(t, testNoTees|testBulkError)
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.SpoolDir = dir
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	lost := 0
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				lost++
+			}
+		}
+	})
+
+	for i := range 25 {
+		osl.Info(i)
+	}
+	osl.Close()
+
+	if lost != 0 {
+		t.Fatalf("messages were lost: %d", lost)
+	}
+	if tc.count.Load() != 0 {
+		t.Fatal("messages should not have been sent")
+	}
+
+	sp, recovered, err := openSpool(dir, OslSpoolSyncBatch, OslDefaultSpoolSegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.close()
+
+	if recovered != 25 {
+		t.Fatalf("wrong recovered count: %d", recovered)
+	}
+}
+
+func TestSpoolInvalidSync(t *testing.T) {
+	_, err := NewOpenSearchLane(context.Background(), &OslConfig{SpoolDir: t.TempDir(), SpoolSync: "sometimes"})
+	if err != ErrInvalidSpoolSync {
+		t.Fatal("expected error")
+	}
+}
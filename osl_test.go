@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -889,13 +891,317 @@ func TestPanicOslDerived(t *testing.T) {
 	wg.Wait()
 }
 
+func testMakeFlushLevelOsl(t *testing.T, flushLevel string) (tc *testClient, osl OpenSearchLane) {
+	tc, osl = testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.LogThreshold = 100
+	cfg.FlushLevel = flushLevel
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestPanicOslFlush(t *testing.T) {
+	tc, osl := testMakeFlushLevelOsl(t, "FATAL")
+
+	sent := int32(0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	osl.SetPanicHandler(func() {
+		sent = tc.count.Load()
+		wg.Done()
+		runtime.Goexit()
+	})
+
+	osl.Info("buffered")
+	go func() {
+		osl.Fatal("stop me")
+		panic("unreachable")
+	}()
+	wg.Wait()
+
+	if sent != 2 {
+		t.Errorf("messages were not sent before the panic: %d", sent)
+	}
+}
+
+func TestPanicOslFlushStack(t *testing.T) {
+	tc, osl := testMakeFlushLevelOsl(t, "FATAL")
+	osl.EnableStackTrace(lane.LogLevelFatal, true)
+
+	var sent []*OslMessage
+	var wg sync.WaitGroup
+	wg.Add(1)
+	osl.SetPanicHandler(func() {
+		sent = slices.Clone(tc.lines)
+		wg.Done()
+		runtime.Goexit()
+	})
+
+	go func() {
+		osl.Fatal("stop me")
+		panic("unreachable")
+	}()
+	wg.Wait()
+
+	if len(sent) < 2 || sent[0].Level != "FATAL" {
+		t.Fatalf("messages were not sent before the panic: %+v", sent)
+	}
+	for _, msg := range sent[1:] {
+		if msg.Level != "STACK" {
+			t.Errorf("wrong message sent: %+v", msg)
+		}
+	}
+}
+
+func TestPanicOslTee(t *testing.T) {
+	tc, osl := testMakeFlushLevelOsl(t, "FATAL")
+
+	l := lane.NewLogLane(context.Background())
+	l.AddTee(osl)
+
+	sent := int32(0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	l.SetPanicHandler(func() {
+		sent = tc.count.Load()
+		wg.Done()
+		runtime.Goexit()
+	})
+
+	go func() {
+		l.Fatal("stop me")
+		panic("unreachable")
+	}()
+	wg.Wait()
+
+	if sent != 1 {
+		t.Errorf("the fatal message of the tee was not sent: %d", sent)
+	}
+}
+
+func TestPreFatalFlush(t *testing.T) {
+	tc, osl := testMakeFlushLevelOsl(t, "FATAL")
+	osl.EnableStackTrace(lane.LogLevelFatal, true)
+	derived := osl.Derive()
+
+	derived.PreFatalf("stop %s", "me")
+	if len(tc.lines) < 2 || tc.lines[0].Level != "FATAL" || tc.lines[len(tc.lines)-1].Level != "STACK" {
+		t.Errorf("messages were not sent before returning: %+v", tc.lines)
+	}
+	derived.Close()
+	osl.Close()
+}
+
+func TestFlushLevel(t *testing.T) {
+	tc, osl := testMakeFlushLevelOsl(t, "warn")
+
+	osl.Info("buffered")
+	time.Sleep(50 * time.Millisecond)
+	if tc.count.Load() != 0 {
+		t.Fatal("message should be buffered")
+	}
+
+	osl.Warn("urgent")
+	deadline := time.Now().Add(time.Second)
+	for tc.count.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("messages were not sent right away")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	osl.Close()
+}
+
+func TestFlushLevelBackoff(t *testing.T) {
+	tc, osl := testMakeFlushLevelOsl(t, "ERROR")
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.BackoffInterval = time.Second
+	cfg.BackoffLimit = time.Second * 30
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var lost []*OslMessage
+	var mu sync.Mutex
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				lost = append(lost, msg)
+			}
+		}
+	})
+
+	// an outage; the urgent messages wait for the backoff rather than using it up
+	tc.failure = os.ErrPermission
+	for i := 0; i < 10; i++ {
+		osl.Error("outage")
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lost) != 0 {
+		t.Errorf("messages were dropped during the backoff: %d", len(lost))
+	}
+	if stats := osl.Stats(); stats.MessagesDroppedBackoff != 0 || stats.BatchRetries != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestFlushLevelInvalid(t *testing.T) {
+	cfg := OslConfig{FlushLevel: "LOUD"}
+	if _, err := NewOpenSearchLane(context.Background(), &cfg); !errors.Is(err, ErrInvalidFlushLevel) {
+		t.Fatalf("expected invalid flush level error: %v", err)
+	}
+}
+
+func TestEvictionOrderInvalid(t *testing.T) {
+	for _, order := range [][]string{{"DEBUG", "WARNING"}, {""}} {
+		cfg := OslConfig{EvictionOrder: order}
+		if _, err := NewOpenSearchLane(context.Background(), &cfg); !errors.Is(err, ErrInvalidEvictionOrder) {
+			t.Errorf("%v: expected invalid eviction order error: %v", order, err)
+		}
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	tc, osl := testMakeFirstOsl(t)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.MinLevel = "info"
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	osl.Debug("local only")
+	osl.Info("everywhere")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 1 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+	if !tc.tl.VerifyEventText("DEBUG\tlocal only\nINFO\teverywhere") {
+		t.Errorf("tee should get all messages: %s", tc.tl.EventsToString())
+	}
+	if stats := osl.Stats(); stats.MessagesFiltered != 1 || stats.MessagesQueued != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	prior, err := osl.SetMinLevel("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prior != "INFO" {
+		t.Errorf("wrong prior level: %s", prior)
+	}
+
+	osl.Debug("shipped")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 2 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+
+	// stack traces pass any minimum level below STACK
+	if _, err = osl.SetMinLevel("fatal"); err != nil {
+		t.Fatal(err)
+	}
+	osl.Error("held back")
+	osl.LogStack("stack")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.lines) <= 2 {
+		t.Fatal("stack trace was not sent")
+	}
+	for _, msg := range tc.lines[2:] {
+		if msg.Level != "STACK" {
+			t.Errorf("wrong message sent: %+v", msg)
+		}
+	}
+
+	if _, err = osl.SetMinLevel("verbose"); !errors.Is(err, ErrInvalidMinLevel) {
+		t.Errorf("expected invalid level error: %v", err)
+	}
+	osl.Close()
+}
+
+func TestMinLevelWhileSending(t *testing.T) {
+	// made without testMakeFirstOsl, which changes the pump interval of the running
+	// connection; run with -race
+	tc := &testClient{}
+	tc.install(t)
+	cfg := OslConfig{
+		OpenSearchIndex:     "testing",
+		OpenSearchHost:      "localhost",
+		OpenSearchPort:      1000,
+		OpenSearchTransport: &http.Transport{},
+	}
+	osl, err := NewOpenSearchLane(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := osl.SetMinLevel([]string{"", "info"}[i%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		osl.Info("sent")
+		if err = osl.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	<-done
+
+	if tc.count.Load() != 20 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+	osl.Close()
+}
+
 func TestLogTilFull(t *testing.T) {
 	_, osl := testMakeFirstOslEx(t, testMax10|testOffline|testNoIndex)
 
 	var wg sync.WaitGroup
-	wg.Add(1)
+	wg.Add(2)
 	fails := 0
-	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) { fails = len(logBuffer); wg.Done() })
+	summary := ""
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		if logBuffer[0].AppName == "OpenSearchLane" {
+			summary = logBuffer[0].Message
+		} else {
+			fails = len(logBuffer)
+		}
+		wg.Done()
+	})
 
 	for i := 0; i < 11; i++ {
 		osl.Info(i)
@@ -903,6 +1209,10 @@ func TestLogTilFull(t *testing.T) {
 
 	wg.Wait()
 
+	if summary != "Log buffer is full; evicted 1 INFO" {
+		t.Errorf("wrong overflow report: %s", summary)
+	}
+
 	stats := osl.Stats()
 	if stats.MessagesQueued != 11 {
 		t.Error("wrong queue count")
@@ -913,6 +1223,9 @@ func TestLogTilFull(t *testing.T) {
 	if stats.MessagesSentFailed != fails {
 		t.Error("wrong failed count")
 	}
+	if stats.MessagesDroppedOverflow != fails {
+		t.Error("wrong overflow count")
+	}
 }
 
 func TestLogBulkError(t *testing.T) {
@@ -1198,6 +1511,57 @@ func TestSharding2(t *testing.T) {
 	}
 }
 
+func TestMessageSharding(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+
+	osl.SetIndexSharder(func(baseName string) string { return baseName + "-name" })
+	prior := osl.SetMessageSharder(func(baseName string, msg *OslMessage) string {
+		return baseName + "-" + strings.ToLower(msg.Level) + "-" + msg.Timestamp().Format(time.DateOnly)
+	})
+	if prior != nil {
+		t.Error("unexpected prior sharder")
+	}
+
+	osl.Info("routine")
+	osl.Error("urgent")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	if !slices.Equal(tc.indicies, []string{"testing-info-" + today, "testing-error-" + today}) {
+		t.Errorf("wrong indices: %v", tc.indicies)
+	}
+
+	// the index sharder applies again without a message sharder
+	if prior = osl.SetMessageSharder(nil); prior == nil {
+		t.Error("missing prior sharder")
+	}
+	osl.Info("routine")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.indicies[2] != "testing-name" {
+		t.Errorf("wrong index: %s", tc.indicies[2])
+	}
+	osl.Close()
+}
+
+func TestMessageTimestamp(t *testing.T) {
+	msg := OslMessage{Metadata: map[string]string{"timestamp": "2024-12-31T23:59:59Z"}}
+	if ts := msg.Timestamp(); !ts.Equal(time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)) {
+		t.Errorf("wrong timestamp: %v", ts)
+	}
+
+	msg = OslMessage{}
+	if ts := msg.Timestamp(); !ts.IsZero() {
+		t.Errorf("expected zero timestamp: %v", ts)
+	}
+}
+
 func TestIndexRequired(t *testing.T) {
 	tc := &testClient{}
 	tc.install(t)
@@ -1213,6 +1577,22 @@ func TestIndexRequired(t *testing.T) {
 	}
 }
 
+func TestIndexInvalid(t *testing.T) {
+	tc := &testClient{}
+	tc.install(t)
+	for _, index := range []string{"MyLogs", "_logs", "logs,audit"} {
+		cfg := OslConfig{
+			OpenSearchHost:      "localhost",
+			OpenSearchPort:      1000,
+			OpenSearchTransport: &http.Transport{},
+			OpenSearchIndex:     index,
+		}
+		if _, err := NewOpenSearchLane(context.Background(), &cfg); !errors.Is(err, ErrInvalidIndexName) {
+			t.Errorf("%s: expected invalid index name error: %v", index, err)
+		}
+	}
+}
+
 func TestNilConfig(t *testing.T) {
 	osl, err := NewOpenSearchLane(context.Background(), nil)
 	if err != nil {
@@ -1221,3 +1601,857 @@ func TestNilConfig(t *testing.T) {
 
 	osl.Info("test")
 }
+
+func TestLogLineFields(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	osl.SetJourneyId("journey")
+	osl.Warn("test", "of", "warn")
+
+	tc.waitForBulk(1)
+
+	msg := tc.lines[0]
+	if msg.Level != "WARN" {
+		t.Errorf("wrong level: %s", msg.Level)
+	}
+	if msg.Prefix != "WARN {journey:"+osl.LaneId()+"}" {
+		t.Errorf("wrong prefix: %s", msg.Prefix)
+	}
+	if msg.Message != "test of warn" {
+		t.Errorf("wrong message: %s", msg.Message)
+	}
+	if msg.LogMessage != msg.Prefix+" "+msg.Message {
+		t.Errorf("wrong log message: %s", msg.LogMessage)
+	}
+}
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line, level, prefix, message string
+	}{
+		{"INFO {abc} text", "INFO", "INFO {abc}", "text"},
+		{"ERROR {j:abc} multi\nline", "ERROR", "ERROR {j:abc}", "multi\nline"},
+		{"INFO {abc} ", "INFO", "INFO {abc}", ""},
+		{"INFO text", "INFO", "INFO", "text"},
+		{"INFO", "INFO", "INFO", ""},
+	}
+
+	for _, test := range tests {
+		level, prefix, message := parseLogLine(test.line)
+		if level != test.level || prefix != test.prefix || message != test.message {
+			t.Errorf("parse of %q failed: %q %q %q", test.line, level, prefix, message)
+		}
+	}
+}
+
+func TestOmitLogMessage(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.OmitLogMessage = true
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	osl.Info("test")
+	tc.waitForBulk(1)
+
+	msg := tc.lines[0]
+	if msg.LogMessage != "" {
+		t.Errorf("log message not omitted: %s", msg.LogMessage)
+	}
+	if msg.Level != "INFO" || msg.Message != "test" {
+		t.Errorf("wrong parsed fields: %s %s", msg.Level, msg.Message)
+	}
+}
+
+func TestLogBulkPartialFailure(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees|testMax10)
+
+	var mu sync.Mutex
+	var rejected []*OslMessage
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range logBuffer {
+			if msg.RejectReason != "" {
+				rejected = append(rejected, msg)
+			}
+		}
+	})
+
+	deferred := 0
+	tc.itemStatusFn = func(msg *OslMessage) int {
+		switch msg.Message {
+		case "reject":
+			return http.StatusBadRequest
+		case "retry":
+			deferred++
+			if deferred == 1 {
+				return http.StatusTooManyRequests
+			}
+		}
+		return http.StatusCreated
+	}
+
+	osl.Info("ok")
+	osl.Info("reject")
+	osl.Info("retry")
+
+	tc.waitForBulk(2)
+
+	for range 100 {
+		stats := osl.Stats()
+		if stats.MessagesSent == 2 && stats.MessagesSentFailed == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesSent != 2 {
+		t.Errorf("wrong sent count: %d", stats.MessagesSent)
+	}
+	if stats.MessagesSentFailed != 1 {
+		t.Errorf("wrong failed count: %d", stats.MessagesSentFailed)
+	}
+	if deferred != 2 {
+		t.Errorf("retryable message was not retried: %d", deferred)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rejected) != 1 || rejected[0].Message != "reject" {
+		t.Fatal("rejected message was not sent to the emergency handler")
+	}
+	if rejected[0].RejectReason != "test_exception: status 400" {
+		t.Errorf("wrong reject reason: %s", rejected[0].RejectReason)
+	}
+}
+
+func TestCompressedBulk(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.CompressRequests = true
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	osl.Info("test", "of", "compression")
+
+	if !tc.VerifyReceived("INFO\ttest of compression") {
+		t.Errorf("Test events don't match")
+	}
+	if tc.compressed.Load() != 1 {
+		t.Error("request was not compressed")
+	}
+}
+
+func TestBulkSplitBySize(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.MaxBulkBytes = 1024
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// hold the flush until all messages are queued
+	osc := p.openSearchConnection
+	osc.mu.Lock()
+	for i := range 20 {
+		osc.logBuffer = append(osc.logBuffer, &OslMessage{Message: fmt.Sprintf("message %d %s", i, strings.Repeat("x", 200))})
+		osc.messagesQueued++
+	}
+	osc.mu.Unlock()
+
+	tc.waitForBulk(20)
+
+	if tc.requests.Load() < 4 {
+		t.Errorf("flush was not split: %d requests", tc.requests.Load())
+	}
+	for i, line := range tc.lines {
+		if !strings.HasPrefix(line.Message, fmt.Sprintf("message %d ", i)) {
+			t.Fatalf("wrong order at %d", i)
+		}
+	}
+}
+
+func TestBulkTooLarge(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+	tc.maxBodyBytes = 2048
+
+	var mu sync.Mutex
+	var rejected []*OslMessage
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range logBuffer {
+			if msg.RejectReason != "" {
+				rejected = append(rejected, msg)
+			}
+		}
+	})
+
+	p := osl.(*openSearchLane)
+	osc := p.openSearchConnection
+	osc.mu.Lock()
+	for i := range 16 {
+		osc.logBuffer = append(osc.logBuffer, &OslMessage{Message: fmt.Sprintf("message %d %s", i, strings.Repeat("x", 200))})
+		osc.messagesQueued++
+	}
+	osc.logBuffer = append(osc.logBuffer, &OslMessage{Message: strings.Repeat("y", 4096)})
+	osc.messagesQueued++
+	osc.mu.Unlock()
+
+	tc.waitForBulk(16)
+
+	for range 100 {
+		stats := osl.Stats()
+		if stats.MessagesSent+stats.MessagesSentFailed == 17 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesSent != 16 || stats.MessagesSentFailed != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rejected) != 1 || rejected[0].RejectReason != "request entity too large" {
+		t.Fatal("oversized message was not rejected")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees|testMax10)
+	tc.delay = time.Second
+
+	p := osl.(*openSearchLane)
+	cfg := *p.openSearchConnection.cfg
+	cfg.RequestTimeout = time.Millisecond * 20
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	timedOut := false
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		if len(logBuffer) == 1 && strings.HasSuffix(logBuffer[0].LogMessage, context.DeadlineExceeded.Error()) && !timedOut {
+			timedOut = true
+			wg.Done()
+		}
+	})
+
+	osl.Info("test")
+	wg.Wait()
+}
+
+func TestCloseWithContext(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+	tc.delay = time.Hour
+
+	var mu sync.Mutex
+	var lost []string
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				lost = append(lost, msg.Message)
+			}
+		}
+	})
+
+	osl.Info("first")
+	time.Sleep(time.Millisecond * 50) // let the pump start sending
+	osl.Info("second")
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	osl.CloseWithContext(ctx)
+
+	if time.Since(start) > time.Second {
+		t.Fatal("close was not bounded by the context")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lost) != 2 || lost[0] != "first" || lost[1] != "second" {
+		t.Fatalf("unsent messages were not passed to the emergency handler: %v", lost)
+	}
+}
+
+func TestFlushContext(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+
+	osl.Info("flushed")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 1 {
+		t.Fatal("message was not flushed")
+	}
+
+	tc.delay = time.Hour
+	osl.Info("slow")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := osl.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error: %v", err)
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.SpoolDir = t.TempDir()
+	cfg.MaxBufferSize = 5
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 12 {
+		osl.Info(i)
+	}
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 12 {
+		t.Fatalf("messages were not flushed: %d", tc.count.Load())
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesQueued != 12 || stats.MessagesSent != 12 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	osl.Close()
+}
+
+func TestFlushRejected(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+
+	tc.itemStatusFn = func(msg *OslMessage) int {
+		if msg.Message == "reject" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}
+
+	osl.Info("ok")
+	osl.Info("reject")
+	err := osl.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "1 rejected") {
+		t.Fatalf("expected rejection error: %v", err)
+	}
+	if tc.count.Load() != 1 {
+		t.Fatal("accepted message was not sent")
+	}
+}
+
+func TestStatsDetail(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+
+	tc.itemStatusFn = func(msg *OslMessage) int {
+		if msg.Message == "reject" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}
+
+	start := time.Now()
+	osl.Info("ok")
+	osl.Info("reject")
+	if err := osl.Flush(context.Background()); err == nil {
+		t.Fatal("expected rejection error")
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesSent != 1 || stats.MessagesRejected != 1 || stats.MessagesSentFailed != 1 {
+		t.Errorf("wrong message counts: %+v", stats)
+	}
+	if stats.BulkRequests != 1 || stats.BulkRequestsSucceeded != 1 || stats.BytesSent == 0 {
+		t.Errorf("wrong request counts: %+v", stats)
+	}
+	if !strings.Contains(stats.LastError, "1 rejected") || stats.LastErrorTime.Before(start) {
+		t.Errorf("wrong last error: %s at %v", stats.LastError, stats.LastErrorTime)
+	}
+	if stats.LastSendTime.Before(start) {
+		t.Errorf("wrong last send time: %v", stats.LastSendTime)
+	}
+	if !stats.Connected || stats.BackoffDuration != 0 {
+		t.Errorf("wrong connection state: %+v", stats)
+	}
+
+	lastSend := stats.LastSendTime
+	tc.failure = os.ErrPermission
+	osl.Info("unsent")
+	if err := osl.Flush(context.Background()); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected bulk error: %v", err)
+	}
+
+	stats = osl.Stats()
+	if stats.BulkRequests != 2 || stats.BulkRequestsSucceeded != 1 {
+		t.Errorf("wrong request counts: %+v", stats)
+	}
+	if stats.BatchRetries != 1 || stats.BackoffDuration == 0 {
+		t.Errorf("wrong retry state: %+v", stats)
+	}
+	if !strings.Contains(stats.LastError, "permission denied") {
+		t.Errorf("wrong last error: %s", stats.LastError)
+	}
+	if !stats.LastSendTime.Equal(lastSend) {
+		t.Error("last send time should not change")
+	}
+
+	tc.failure = nil
+	osl.Close()
+
+	stats = osl.Stats()
+	if stats.MessagesSent != 2 || stats.MessagesDroppedFinal != 0 {
+		t.Errorf("wrong final counts: %+v", stats)
+	}
+}
+
+func TestStatsDroppedFinal(t *testing.T) {
+	_, osl := testMakeFirstOslEx(t, testOffline|testNoIndex)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) { wg.Done() })
+
+	osl.Info("unsent")
+	osl.Close()
+	wg.Wait()
+
+	stats := osl.Stats()
+	if stats.MessagesDroppedFinal != 1 || stats.MessagesSentFailed != 1 || stats.Connected {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestFlushDeferred(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	tc.failure = os.ErrPermission
+
+	osl.Info("unsent")
+	if err := osl.Flush(context.Background()); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected bulk error: %v", err)
+	}
+
+	// the message stays buffered for the next attempt
+	tc.failure = nil
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 1 {
+		t.Fatal("message was not sent")
+	}
+}
+
+func TestFlushOffline(t *testing.T) {
+	osl, err := NewOpenSearchLane(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatalf("nothing to flush: %v", err)
+	}
+
+	osl.Info("offline")
+	if err = osl.Flush(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected offline error: %v", err)
+	}
+
+	osl.Close()
+	if err = osl.Flush(context.Background()); !errors.Is(err, ErrLaneClosed) {
+		t.Fatalf("expected closed error: %v", err)
+	}
+}
+
+func testMakeOverflowOsl(t *testing.T, policy OslOverflowPolicy) (tc *testClient, osl OpenSearchLane, dropped chan *OslMessage) {
+	tc, osl = testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.MaxBufferSize = 5
+	cfg.LogThreshold = 100
+	cfg.BackoffInterval = time.Hour
+	cfg.BackoffLimit = 2 * time.Hour
+	cfg.OverflowPolicy = policy
+	cfg.OverflowTimeout = 50 * time.Millisecond
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped = make(chan *OslMessage, 10)
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		for _, msg := range logBuffer {
+			// skip the reports of the failed requests
+			if msg.Level == "INFO" {
+				dropped <- msg
+			}
+		}
+	})
+	return
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	tc, osl, dropped := testMakeOverflowOsl(t, OslOverflowDropNewest)
+
+	for i := range 7 {
+		osl.Info(i)
+	}
+
+	for _, expected := range []string{"5", "6"} {
+		if msg := <-dropped; msg.Message != expected {
+			t.Errorf("wrong message dropped: %s", msg.Message)
+		}
+	}
+
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 5 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+
+	stats := osl.Stats()
+	if stats.MessagesDroppedOverflow != 2 || stats.MessagesSentFailed != 2 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	// the buffer has room again
+	osl.Info("more")
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 6 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+	osl.Close()
+}
+
+func TestOverflowBlock(t *testing.T) {
+	tc, osl, dropped := testMakeOverflowOsl(t, OslOverflowBlock)
+	tc.failure = os.ErrPermission
+
+	for i := range 5 {
+		osl.Info(i)
+	}
+
+	start := time.Now()
+	osl.Info("timed out")
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("log call did not wait for room")
+	}
+
+	if msg := <-dropped; msg.Message != "timed out" {
+		t.Errorf("wrong message dropped: %s", msg.Message)
+	}
+
+	tc.failure = nil
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 5 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+	osl.Close()
+}
+
+func TestOverflowBlockForever(t *testing.T) {
+	tc, osl, dropped := testMakeOverflowOsl(t, OslOverflowBlockForever)
+	tc.failure = os.ErrPermission
+
+	for i := range 5 {
+		osl.Info(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		osl.Info("waited")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("log call did not wait for room")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	tc.failure = nil
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 6 {
+		t.Errorf("wrong number of messages sent: %d", tc.count.Load())
+	}
+	if len(dropped) != 0 {
+		t.Error("no message should be dropped")
+	}
+	osl.Close()
+}
+
+func TestOverflowBlockOffline(t *testing.T) {
+	cfg := OslConfig{
+		MaxBufferSize:  1,
+		OverflowPolicy: OslOverflowBlockForever,
+	}
+	osl, err := NewOpenSearchLane(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) { wg.Done() })
+
+	// nothing drains the buffer, so waiting would never end
+	osl.Info("kept")
+	osl.Info("dropped")
+	wg.Wait()
+
+	if stats := osl.Stats(); stats.MessagesDroppedOverflow != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestOverflowPolicyInvalid(t *testing.T) {
+	cfg := OslConfig{OverflowPolicy: "wait"}
+	if _, err := NewOpenSearchLane(context.Background(), &cfg); !errors.Is(err, ErrInvalidOverflowPolicy) {
+		t.Fatalf("expected invalid policy error: %v", err)
+	}
+}
+
+func TestOverflowEviction(t *testing.T) {
+	cfg := OslConfig{MaxBufferSize: 5}
+	osl, err := NewOpenSearchLane(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evicted []string
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				evicted = append(evicted, msg.Level+" "+msg.Message)
+			}
+		}
+	})
+
+	osl.Trace("a")
+	osl.Error("b")
+	osl.Debug("c")
+	osl.Info("d")
+	osl.Trace("e")
+
+	osl.Warn("f")
+	osl.Info("g")
+	osl.Error("h")
+
+	expected := []string{"TRACE a", "TRACE e", "DEBUG c"}
+	if !slices.Equal(evicted, expected) {
+		t.Errorf("wrong messages evicted: %v", evicted)
+	}
+
+	stats := osl.Stats()
+	if !maps.Equal(stats.OverflowByLevel, map[string]int{"TRACE": 2, "DEBUG": 1}) {
+		t.Errorf("wrong overflow stats: %v", stats.OverflowByLevel)
+	}
+	if stats.MessagesDroppedOverflow != 3 {
+		t.Errorf("wrong overflow count: %d", stats.MessagesDroppedOverflow)
+	}
+}
+
+func TestOverflowEvictionNewest(t *testing.T) {
+	cfg := OslConfig{MaxBufferSize: 3}
+	osl, err := NewOpenSearchLane(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evicted []string
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				evicted = append(evicted, msg.Level+" "+msg.Message)
+			}
+		}
+	})
+
+	// the new message is the lowest in the eviction order
+	osl.Error("e1")
+	osl.Error("e2")
+	osl.Error("e3")
+	osl.Trace("t")
+
+	if !slices.Equal(evicted, []string{"TRACE t"}) {
+		t.Errorf("wrong messages evicted: %v", evicted)
+	}
+}
+
+func TestOverflowEvictionInFlight(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.MaxBufferSize = 11
+	cfg.LogThreshold = 10
+	cfg.FlushLevel = "FATAL"
+	tc.delay = 250 * time.Millisecond
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var evicted []string
+	osl.SetEmergencyHandler(func(logBuffer []*OslMessage) {
+		for _, msg := range logBuffer {
+			if msg.AppName != "OpenSearchLane" {
+				evicted = append(evicted, msg.Level+" "+msg.Message)
+			}
+		}
+	})
+
+	// a batch of 10 in flight leaves room for one more message
+	for i := 0; i < 10; i++ {
+		osl.Info("in flight")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	osl.Error("the one we need")
+	osl.Trace("t")
+	if !slices.Equal(evicted, []string{"TRACE t"}) {
+		t.Errorf("wrong messages evicted: %v", evicted)
+	}
+
+	if err := osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tc.count.Load() != 11 || tc.lines[10].Message != "the one we need" {
+		t.Errorf("wrong messages sent: %d", tc.count.Load())
+	}
+	osl.Close()
+}
+
+func TestLogThresholdAfterFailures(t *testing.T) {
+	tc, osl := testMakeFirstOslEx(t, testNoTees)
+
+	p := osl.(*openSearchLane)
+	p.openSearchConnection.pumpInterval = time.Hour
+	cfg := *p.openSearchConnection.cfg
+	cfg.LogThreshold = 5
+	cfg.FlushLevel = "FATAL"
+	if err := osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	tc.itemStatusFn = func(msg *OslMessage) int {
+		if msg.Message == "reject" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}
+	for range 3 {
+		osl.Info("reject")
+	}
+	if err := osl.Flush(context.Background()); err == nil {
+		t.Fatal("expected rejection error")
+	}
+
+	// the rejected messages are not pending, so the batch is sent at the threshold
+	for i := range 4 {
+		osl.Infof("message %d", i)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if tc.count.Load() != 0 {
+		t.Fatalf("sent before the threshold: %d", tc.count.Load())
+	}
+	osl.Info("message 4")
+	for range 200 {
+		if tc.count.Load() == 5 {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if tc.count.Load() != 5 || tc.requests.Load() != 2 {
+		t.Errorf("wrong batches: %d messages in %d requests", tc.count.Load(), tc.requests.Load())
+	}
+	osl.Close()
+}
+
+func TestEvict(t *testing.T) {
+	buffer := []*OslMessage{
+		{Level: "INFO", Message: "0"},
+		{Level: "ERROR", Message: "1"},
+		{Level: "CUSTOM", Message: "2"},
+		{Level: "DEBUG", Message: "3"},
+		{Level: "INFO", Message: "4"},
+	}
+
+	tests := []struct {
+		n       int
+		order   []string
+		evicted string
+	}{
+		{1, OslDefaultEvictionOrder, "3"},
+		{2, OslDefaultEvictionOrder, "03"},
+		{3, OslDefaultEvictionOrder, "034"},
+		{4, OslDefaultEvictionOrder, "0134"},
+		{5, OslDefaultEvictionOrder, "01234"},
+		{2, []string{"ERROR"}, "01"},
+		{2, nil, "01"},
+	}
+
+	for _, test := range tests {
+		kept, evicted := evict(buffer, test.n, test.order)
+		var sb strings.Builder
+		for _, msg := range evicted {
+			sb.WriteString(msg.Message)
+		}
+		if sb.String() != test.evicted {
+			t.Errorf("evicting %d by %v: expected %s, got %s", test.n, test.order, test.evicted, sb.String())
+		}
+		if len(kept)+len(evicted) != len(buffer) {
+			t.Errorf("evicting %d by %v: wrong kept count %d", test.n, test.order, len(kept))
+		}
+	}
+
+	// stack trace lines are evicted first by default
+	stacked := append(slices.Clone(buffer), &OslMessage{Level: "STACK", Message: "5"})
+	if _, evicted := evict(stacked, 1, OslDefaultEvictionOrder); len(evicted) != 1 || evicted[0].Message != "5" {
+		t.Errorf("wrong eviction: %+v", evicted)
+	}
+}
@@ -0,0 +1,256 @@
+package osl
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPem []byte
+	keyPem  []byte
+}
+
+// Makes a certificate signed by parent, or a self-signed CA if parent is nil.
+func testMakeCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	signerCert := &template
+	signerKey := key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		signerCert = parent.cert
+		signerKey = parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPem:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func testWriteFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOslMutualTls(t *testing.T) {
+	ca := testMakeCert(t, "test CA", nil, 0)
+	server := testMakeCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	client := testMakeCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	serverCert, err := tls.X509KeyPair(server.certPem, server.keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	stub := newTlsStubServer(t, nil, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	defer stub.Close()
+
+	dir := t.TempDir()
+	cfg := OslConfig{
+		OpenSearchAddresses: []string{stub.URL()},
+		OpenSearchIndex:     "sample",
+		TlsCertFile:         testWriteFile(t, dir, "client.pem", client.certPem),
+		TlsKeyFile:          testWriteFile(t, dir, "client.key", client.keyPem),
+		TlsCaFile:           testWriteFile(t, dir, "ca.pem", ca.certPem),
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	osl.Info("mutual")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the client certificate, the server refuses the connection
+	cfg.TlsCertFile = ""
+	cfg.TlsKeyFile = ""
+	cfg.BackoffLimit = time.Millisecond
+	if err = osl.Reconnect(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	osl.Info("anonymous")
+	if err = osl.Flush(context.Background()); err == nil {
+		t.Fatal("expected TLS failure")
+	}
+}
+
+func TestOslTlsConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := OslConfig{
+		OpenSearchHost:  "localhost",
+		OpenSearchIndex: "sample",
+		TlsCertFile:     filepath.Join(dir, "client.pem"),
+	}
+	if _, err := NewOpenSearchLane(nil, &cfg); err != ErrIncompleteClientCert {
+		t.Errorf("expected incomplete certificate error: %v", err)
+	}
+
+	cfg.TlsCertFile = ""
+	cfg.TlsCaFile = testWriteFile(t, dir, "ca.pem", []byte("not a certificate"))
+	if _, err := NewOpenSearchLane(nil, &cfg); !errors.Is(err, ErrInvalidCaBundle) {
+		t.Errorf("expected CA bundle error: %v", err)
+	}
+
+	cfg.TlsCaFile = filepath.Join(dir, "missing.pem")
+	if _, err := NewOpenSearchLane(nil, &cfg); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected missing file error: %v", err)
+	}
+}
+
+func TestOslTlsWithTransport(t *testing.T) {
+	cfg := OslConfig{
+		OpenSearchHost:        "localhost",
+		OpenSearchIndex:       "sample",
+		OpenSearchTransport:   &http.Transport{},
+		TlsInsecureSkipVerify: true,
+	}
+	if _, err := NewOpenSearchLane(nil, &cfg); !errors.Is(err, ErrTransportWithTls) {
+		t.Errorf("expected transport with TLS settings error: %v", err)
+	}
+}
+
+func TestOslDefaultTransport(t *testing.T) {
+	stub := newStubServer(t, nil)
+	defer stub.Close()
+
+	// a host connects without a transport, the same as a list of addresses
+	protocol, host, port := stub.Connection()
+	cfg := OslConfig{
+		OpenSearchProtocol: protocol,
+		OpenSearchHost:     host,
+		OpenSearchPort:     port,
+		OpenSearchIndex:    "sample",
+	}
+	osl, err := NewOpenSearchLane(nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	osl.Info("default")
+	if err = osl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the transport made from the TLS settings is made again for a copy of the config
+	osc := osl.(*openSearchLane).openSearchConnection
+	osc.mu.Lock()
+	current := *osc.cfg
+	osc.mu.Unlock()
+	if err = osl.Reconnect(&current); err != nil {
+		t.Fatal(err)
+	}
+	osc.mu.Lock()
+	replaced := osc.cfg.OpenSearchTransport != current.OpenSearchTransport
+	osc.mu.Unlock()
+	if !replaced {
+		t.Error("the transport was not made again")
+	}
+}
+
+func TestOslTokenAuth(t *testing.T) {
+	stub := newStubServer(t, nil)
+	defer stub.Close()
+
+	tests := []struct {
+		cfg    OslConfig
+		header string
+	}{
+		{OslConfig{OpenSearchApiKey: "a2V5OnNlY3JldA=="}, "ApiKey a2V5OnNlY3JldA=="},
+		{OslConfig{OpenSearchBearerToken: "eyJhbGciOi"}, "Bearer eyJhbGciOi"},
+	}
+
+	for _, test := range tests {
+		stub.RequireAuth = func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == test.header
+		}
+
+		cfg := test.cfg
+		cfg.OpenSearchAddresses = []string{stub.URL()}
+		cfg.OpenSearchIndex = "sample"
+		osl, err := NewOpenSearchLane(nil, &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		osl.Info("token")
+		if err = osl.Flush(context.Background()); err != nil {
+			t.Errorf("%s: %v", test.header, err)
+		}
+		osl.Close()
+	}
+}
+
+func TestOslMultipleAuthMethods(t *testing.T) {
+	cfg := OslConfig{
+		OpenSearchHost:   "localhost",
+		OpenSearchIndex:  "sample",
+		OpenSearchUser:   "admin",
+		OpenSearchPass:   "admin",
+		OpenSearchApiKey: "key",
+	}
+	if _, err := NewOpenSearchLane(nil, &cfg); err != ErrMultipleAuthMethods {
+		t.Errorf("expected multiple auth error: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package osl
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jimsnab/go-lane"
+)
+
+func testWriteConfig(t *testing.T, path, index string, modTime time.Time) {
+	content := "openSearchHost: localhost\nopenSearchPort: 1000\nopenSearchIndex: " + index + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWaitForIndex(osl OpenSearchLane, index string) bool {
+	osc := osl.(*openSearchLane).openSearchConnection
+	for range 200 {
+		osc.mu.Lock()
+		current := osc.cfg.OpenSearchIndex
+		osc.mu.Unlock()
+		if current == index {
+			return true
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	return false
+}
+
+func testWatchedLane(t *testing.T, path string) (tl lane.TestingLane, osl OpenSearchLane) {
+	tc := &testClient{}
+	tc.install(t)
+
+	cfg, err := LoadOslConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	osl, err = NewOpenSearchLane(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(osl.Close)
+
+	tl = lane.NewTestingLane(context.Background())
+	tl.SetLogLevel(lane.LogLevelDebug)
+	osl.AddTee(tl)
+	return
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osl.yaml")
+	start := time.Now().Add(-time.Hour)
+	testWriteConfig(t, path, "first", start)
+
+	tl, osl := testWatchedLane(t, path)
+	osc := osl.(*openSearchLane).openSearchConnection
+
+	stop, err := osl.WatchConfigFile(path, time.Millisecond*5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	testWriteConfig(t, path, "second", start.Add(time.Minute))
+	if !testWaitForIndex(osl, "second") {
+		t.Fatal("config was not reloaded")
+	}
+
+	// rewriting the same settings doesn't reconnect
+	osc.mu.Lock()
+	prior := osc.cfg
+	osc.mu.Unlock()
+	testWriteConfig(t, path, "second", start.Add(time.Minute*2))
+	for range 200 {
+		if strings.Contains(tl.EventsToString(), "unchanged") {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	osc.mu.Lock()
+	if osc.cfg != prior {
+		t.Error("unchanged config should not reconnect")
+	}
+	osc.mu.Unlock()
+
+	// an invalid file is reported and the config is kept
+	if err = os.WriteFile(path, []byte("backoffLimit: forever\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for range 200 {
+		if strings.Contains(tl.EventsToString(), "failed") {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	events := tl.EventsToString()
+	if !strings.Contains(events, "OpenSearch config reloaded from "+path+" after file change") {
+		t.Errorf("reload was not logged:\n%s", events)
+	}
+	if !strings.Contains(events, "ERROR\tOpenSearch config reload after file change failed") {
+		t.Errorf("failure was not logged:\n%s", events)
+	}
+	if !testWaitForIndex(osl, "second") {
+		t.Error("config should not have changed")
+	}
+}
+
+func TestWatchConfigCarryOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osl.yaml")
+	start := time.Now().Add(-time.Hour)
+	testWriteConfig(t, path, "first", start)
+
+	tc := &testClient{}
+	tc.install(t)
+
+	cfg, err := LoadOslConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &http.Transport{}
+	cfg.OpenSearchTransport = transport
+	cfg.Credentials = func(ctx context.Context, refresh bool) (user, pass string, err error) {
+		return "admin", "secret", nil
+	}
+	osl, err := NewOpenSearchLane(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+	osc := osl.(*openSearchLane).openSearchConnection
+
+	stop, err := osl.WatchConfigFile(path, time.Millisecond*5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// the callback and transport of the program are kept
+	testWriteConfig(t, path, "second", start.Add(time.Minute))
+	if !testWaitForIndex(osl, "second") {
+		t.Fatal("config was not reloaded")
+	}
+	osc.mu.Lock()
+	if osc.cfg.Credentials == nil || osc.cfg.OpenSearchTransport != transport {
+		t.Error("the credentials callback or transport was dropped")
+	}
+	osc.mu.Unlock()
+
+	// a file with other TLS settings makes a new transport
+	content := "openSearchHost: localhost\nopenSearchPort: 1000\nopenSearchIndex: third\ntlsInsecureSkipVerify: true\n"
+	if err = os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(path, start.Add(time.Minute*2), start.Add(time.Minute*2)); err != nil {
+		t.Fatal(err)
+	}
+	if !testWaitForIndex(osl, "third") {
+		t.Fatal("config was not reloaded")
+	}
+	osc.mu.Lock()
+	if osc.cfg.Credentials == nil || osc.cfg.OpenSearchTransport == transport || osc.cfg.OpenSearchTransport == nil {
+		t.Error("the transport was not replaced")
+	}
+	osc.mu.Unlock()
+}
+
+func TestWatchConfigTlsRotation(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	caFile := testWriteFile(t, dir, "ca.pem", testMakeCert(t, "first CA", nil, 0).certPem)
+	if err := os.Chtimes(caFile, start, start); err != nil {
+		t.Fatal(err)
+	}
+	content := "openSearchHost: localhost\nopenSearchPort: 1000\nopenSearchIndex: sample\ntlsCaFile: " + caFile + "\n"
+	path := testWriteFile(t, dir, "osl.yaml", []byte(content))
+
+	_, osl := testWatchedLane(t, path)
+	osc := osl.(*openSearchLane).openSearchConnection
+	osc.mu.Lock()
+	prior := osc.cfg.OpenSearchTransport
+	osc.mu.Unlock()
+
+	stop, err := osl.WatchConfigFile(path, time.Millisecond*5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// the CA is replaced at the same path, and the config file is unchanged
+	ca := testMakeCert(t, "second CA", nil, 0)
+	testWriteFile(t, dir, "ca.pem", ca.certPem)
+	if err = os.Chtimes(caFile, start.Add(time.Minute), start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	var transport *http.Transport
+	for range 200 {
+		osc.mu.Lock()
+		transport = osc.cfg.OpenSearchTransport
+		osc.mu.Unlock()
+		if transport != prior {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if transport == prior {
+		t.Fatal("the transport was not made again")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	if !transport.TLSClientConfig.RootCAs.Equal(pool) {
+		t.Error("the new transport doesn't trust the replaced CA")
+	}
+}
+
+func TestWatchConfigLaneClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osl.yaml")
+	start := time.Now().Add(-time.Hour)
+	testWriteConfig(t, path, "first", start)
+
+	tc := &testClient{}
+	tc.install(t)
+
+	cfg, err := LoadOslConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	osl, err := NewOpenSearchLane(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the watching ends with the lane that started it, while a derived lane remains
+	derived := osl.Derive().(OpenSearchLane)
+	defer derived.Close()
+	watching, err := derived.WatchConfigFile(path, time.Millisecond*5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watching()
+	if _, err = osl.WatchConfigFile(path, time.Millisecond*5, false); err != nil {
+		t.Fatal(err)
+	}
+	osl.Close()
+
+	testWriteConfig(t, path, "second", start.Add(time.Minute))
+	if !testWaitForIndex(derived, "second") {
+		t.Fatal("config was not reloaded")
+	}
+
+	// only the closed lane's watcher stopped
+	watching()
+	testWriteConfig(t, path, "third", start.Add(time.Minute*2))
+	if testWaitForIndex(derived, "third") {
+		t.Error("the watching should have ended with the lane")
+	}
+}
+
+func TestCarryOverConfig(t *testing.T) {
+	awsCredentials := StaticAwsCredentials("id", "secret", "")
+	credentials := func(ctx context.Context, refresh bool) (user, pass string, err error) {
+		return
+	}
+	current := OslConfig{Credentials: credentials, AwsSigV4: &OslAwsSigV4{Region: "us-west-2", Credentials: awsCredentials}}
+
+	// the AWS callback is kept, and the credentials callback would be a second method
+	cfg := OslConfig{AwsSigV4: &OslAwsSigV4{Region: "us-east-1"}}
+	carryOverConfig(&cfg, &current)
+	if cfg.Credentials != nil || cfg.AwsSigV4.Credentials == nil {
+		t.Errorf("wrong callbacks: %+v", cfg)
+	}
+
+	// a file with a password replaces the credentials callback
+	cfg = OslConfig{OpenSearchUser: "admin", OpenSearchPass: "secret"}
+	carryOverConfig(&cfg, &current)
+	if cfg.Credentials != nil {
+		t.Error("the credentials callback should not be kept")
+	}
+}
+
+func TestWatchConfigSighup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osl.yaml")
+	modTime := time.Now().Add(-time.Hour)
+	testWriteConfig(t, path, "first", modTime)
+
+	_, osl := testWatchedLane(t, path)
+
+	stop, err := osl.WatchConfigFile(path, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// the same modification time and size, so only SIGHUP notices
+	testWriteConfig(t, path, "fresh", modTime)
+	if err = syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	if !testWaitForIndex(osl, "fresh") {
+		t.Fatal("config was not reloaded upon SIGHUP")
+	}
+}
+
+func TestWatchConfigMissing(t *testing.T) {
+	osl, err := NewOpenSearchLane(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osl.Close()
+
+	if _, err = osl.WatchConfigFile(filepath.Join(t.TempDir(), "missing.yaml"), 0, false); !os.IsNotExist(err) {
+		t.Errorf("expected missing file error: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Publishes the upload pipeline metrics of an OpenSearch lane to Prometheus.
+//
+//	c := oslprom.NewCollector(l, "")
+//	prometheus.MustRegister(c)
+//
+// The collector is kept apart from the osl package, so that only the programs that
+// register it depend on the Prometheus client.
+package oslprom
+
+import (
+	"time"
+
+	osl "github.com/jimsnab/go-lane-opensearch"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Prometheus collector of the upload pipeline metrics of an OpenSearch lane.
+	Collector struct {
+		l               osl.OpenSearchLane
+		stop            func()
+		queued          *prometheus.Desc
+		sent            *prometheus.Desc
+		failed          *prometheus.Desc
+		dropped         *prometheus.Desc
+		retries         *prometheus.Desc
+		requests        *prometheus.Desc
+		requestsFailed  *prometheus.Desc
+		payloadBytes    *prometheus.Desc
+		bufferDepth     *prometheus.Desc
+		backoff         *prometheus.Desc
+		connected       *prometheus.Desc
+		requestDuration prometheus.Histogram
+	}
+)
+
+// Makes a Prometheus collector of the metrics of the lane's connection, which is shared
+// by the lanes derived from it. The metric names start with namespace, or "osl" if
+// namespace is empty. Register the collector to publish the metrics.
+//
+// The collector observes the bulk request durations of the connection until Stop is
+// called. Any number of collectors can observe the same connection.
+func NewCollector(l osl.OpenSearchLane, namespace string) *Collector {
+	if namespace == "" {
+		namespace = "osl"
+	}
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil)
+	}
+
+	c := Collector{
+		l:              l,
+		queued:         desc("messages_queued_total", "Log messages queued for upload."),
+		sent:           desc("messages_sent_total", "Log messages stored by OpenSearch."),
+		failed:         desc("messages_failed_total", "Log messages that could not be stored, for any reason."),
+		dropped:        desc("messages_dropped_total", "Log messages dropped because the buffer was full."),
+		retries:        desc("batch_retries_total", "Batches that had to be sent again."),
+		requests:       desc("bulk_requests_total", "Bulk requests sent to OpenSearch."),
+		requestsFailed: desc("bulk_requests_failed_total", "Bulk requests that failed."),
+		payloadBytes:   desc("bulk_payload_bytes_total", "Bytes of the bulk request bodies that were sent successfully."),
+		bufferDepth:    desc("buffer_depth", "Log messages waiting to be sent."),
+		backoff:        desc("backoff_seconds", "Current delay before the next attempt to send, or zero."),
+		connected:      desc("connected", "1 if the lane has an OpenSearch connection, 0 in offline mode."),
+		requestDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bulk_request_duration_seconds",
+			Help:      "Duration of the bulk requests to OpenSearch.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}),
+	}
+
+	c.stop = l.ObserveRequests(func(duration time.Duration, err error) {
+		c.requestDuration.Observe(duration.Seconds())
+	})
+
+	return &c
+}
+
+// Stops observing the bulk request durations. The other metrics are still collected.
+func (c *Collector) Stop() {
+	c.stop()
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queued
+	ch <- c.sent
+	ch <- c.failed
+	ch <- c.dropped
+	ch <- c.retries
+	ch <- c.requests
+	ch <- c.requestsFailed
+	ch <- c.payloadBytes
+	ch <- c.bufferDepth
+	ch <- c.backoff
+	ch <- c.connected
+	c.requestDuration.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.l.Stats()
+
+	depth := max(stats.MessagesQueued-stats.MessagesSent-stats.MessagesSentFailed, 0)
+	connected := 0.0
+	if stats.Connected {
+		connected = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.CounterValue, float64(stats.MessagesQueued))
+	ch <- prometheus.MustNewConstMetric(c.sent, prometheus.CounterValue, float64(stats.MessagesSent))
+	ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(stats.MessagesSentFailed))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(stats.MessagesDroppedOverflow))
+	ch <- prometheus.MustNewConstMetric(c.retries, prometheus.CounterValue, float64(stats.BatchRetries))
+	ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(stats.BulkRequests))
+	ch <- prometheus.MustNewConstMetric(c.requestsFailed, prometheus.CounterValue, float64(stats.BulkRequests-stats.BulkRequestsSucceeded))
+	ch <- prometheus.MustNewConstMetric(c.payloadBytes, prometheus.CounterValue, float64(stats.BytesSent))
+	ch <- prometheus.MustNewConstMetric(c.bufferDepth, prometheus.GaugeValue, float64(depth))
+	ch <- prometheus.MustNewConstMetric(c.backoff, prometheus.GaugeValue, stats.BackoffDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, connected)
+	c.requestDuration.Collect(ch)
+}
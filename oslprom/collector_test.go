@@ -0,0 +1,162 @@
+package oslprom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	osl "github.com/jimsnab/go-lane-opensearch"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Makes a lane connected to a stub OpenSearch server, which fails the bulk requests
+// while failing is set.
+func testMakeLane(t *testing.T, failing *atomic.Bool) osl.OpenSearchLane {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.Contains(r.URL.Path, "_bulk") {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(w, `{"took": 1, "errors": false}`)
+	}))
+	t.Cleanup(server.Close)
+
+	// a long backoff keeps a failed batch from being retried during the test
+	cfg := osl.OslConfig{
+		OpenSearchAddresses: []string{server.URL},
+		OpenSearchIndex:     "testing",
+		MaxBufferSize:       10,
+		BackoffInterval:     time.Hour,
+		BackoffLimit:        time.Hour * 10,
+	}
+	l, err := osl.NewOpenSearchLane(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func testGatherMetrics(t *testing.T, reg *prometheus.Registry) map[string]*dto.Metric {
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := map[string]*dto.Metric{}
+	for _, family := range families {
+		metrics[family.GetName()] = family.GetMetric()[0]
+	}
+	return metrics
+}
+
+func TestCollector(t *testing.T) {
+	var failing atomic.Bool
+	l := testMakeLane(t, &failing)
+
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(NewCollector(l, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 5 {
+		l.Info(i)
+	}
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := testGatherMetrics(t, reg)
+	if metrics["osl_messages_queued_total"].GetCounter().GetValue() != 5 || metrics["osl_messages_sent_total"].GetCounter().GetValue() != 5 {
+		t.Error("wrong message counts")
+	}
+	if metrics["osl_bulk_requests_total"].GetCounter().GetValue() != 1 || metrics["osl_bulk_payload_bytes_total"].GetCounter().GetValue() == 0 {
+		t.Error("wrong request counts")
+	}
+	if metrics["osl_bulk_request_duration_seconds"].GetHistogram().GetSampleCount() != 1 {
+		t.Error("request duration was not observed")
+	}
+	if metrics["osl_connected"].GetGauge().GetValue() != 1 || metrics["osl_buffer_depth"].GetGauge().GetValue() != 0 {
+		t.Error("wrong connection gauges")
+	}
+
+	// fail, then overflow the buffer
+	failing.Store(true)
+	l.Info("fails")
+	if err := l.Flush(context.Background()); err == nil {
+		t.Fatal("expected failure")
+	}
+	for i := range 12 {
+		l.Info(i)
+	}
+
+	metrics = testGatherMetrics(t, reg)
+	if metrics["osl_bulk_requests_failed_total"].GetCounter().GetValue() != 1 || metrics["osl_batch_retries_total"].GetCounter().GetValue() != 1 {
+		t.Error("wrong failure counts")
+	}
+	if metrics["osl_messages_dropped_total"].GetCounter().GetValue() == 0 {
+		t.Error("overflow was not counted")
+	}
+	if metrics["osl_backoff_seconds"].GetGauge().GetValue() != time.Hour.Seconds() {
+		t.Errorf("wrong backoff: %v", metrics["osl_backoff_seconds"].GetGauge().GetValue())
+	}
+	if metrics["osl_buffer_depth"].GetGauge().GetValue() != 10 {
+		t.Errorf("wrong buffer depth: %v", metrics["osl_buffer_depth"].GetGauge().GetValue())
+	}
+}
+
+func TestCollectorShared(t *testing.T) {
+	var failing atomic.Bool
+	l := testMakeLane(t, &failing)
+	defer l.Close()
+
+	// a second collector doesn't take the request durations from the first
+	first, second := NewCollector(l, "first"), NewCollector(l, "second")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(first, second)
+
+	l.Info("observed")
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Stop()
+	l.Info("observed by the first")
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := testGatherMetrics(t, reg)
+	if metrics["first_bulk_request_duration_seconds"].GetHistogram().GetSampleCount() != 2 ||
+		metrics["second_bulk_request_duration_seconds"].GetHistogram().GetSampleCount() != 1 {
+		t.Error("wrong request duration counts")
+	}
+}
+
+func TestCollectorOffline(t *testing.T) {
+	l, err := osl.NewOpenSearchLane(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(NewCollector(l, "myapp_logging")); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("offline")
+	metrics := testGatherMetrics(t, reg)
+	if metrics["myapp_logging_connected"].GetGauge().GetValue() != 0 || metrics["myapp_logging_buffer_depth"].GetGauge().GetValue() != 1 {
+		t.Error("wrong offline metrics")
+	}
+}
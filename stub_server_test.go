@@ -1,10 +1,12 @@
 package osl
 
 import (
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -16,16 +18,28 @@ import (
 )
 
 type stubServer struct {
-	server   *httptest.Server
-	t        *testing.T
-	wg       *sync.WaitGroup
-	Force401 bool
+	server       *httptest.Server
+	t            *testing.T
+	wg           *sync.WaitGroup
+	Force401     bool
+	RequireAuth  func(r *http.Request) bool
+	BulkResponse string
+	MaxBodySize  int
+	mu           sync.Mutex
+	compressed   int
+	lastBody     string
+	lastHeader   http.Header
 }
 
 func newStubServer(t *testing.T, wg *sync.WaitGroup) *stubServer {
+	return newTlsStubServer(t, wg, nil)
+}
+
+// newTlsStubServer makes a stub server that serves HTTPS with tlsConfig, or HTTP if tlsConfig is nil.
+func newTlsStubServer(t *testing.T, wg *sync.WaitGroup, tlsConfig *tls.Config) *stubServer {
 	s := &stubServer{t: t, wg: wg}
 
-	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// handle the GET / request for cluster info
 		if r.Method == http.MethodGet && r.URL.Path == "/" {
 			w.WriteHeader(http.StatusOK)
@@ -35,17 +49,43 @@ func newStubServer(t *testing.T, wg *sync.WaitGroup) *stubServer {
 
 		// handle the _bulk requests
 		if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "_bulk") {
-			if s.Force401 {
+			if s.Force401 || (s.RequireAuth != nil && !s.RequireAuth(r)) {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
-			body, err := io.ReadAll(r.Body)
+			defer r.Body.Close()
+
+			var reader io.Reader = r.Body
+			gzipped := r.Header.Get("Content-Encoding") == "gzip"
+			if gzipped {
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					t.Errorf("failed to decompress request body: %v", err)
+					http.Error(w, "failed to decompress request body", http.StatusBadRequest)
+					return
+				}
+				reader = zr
+			}
+
+			body, err := io.ReadAll(reader)
 			if err != nil {
 				t.Errorf("failed to read request body: %v", err)
 				http.Error(w, "failed to read request body", http.StatusInternalServerError)
 				return
 			}
-			defer r.Body.Close()
+
+			if s.MaxBodySize > 0 && len(body) > s.MaxBodySize {
+				http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			s.mu.Lock()
+			if gzipped {
+				s.compressed++
+			}
+			s.lastBody = string(body)
+			s.lastHeader = r.Header.Clone()
+			s.mu.Unlock()
 
 			// validate the request body
 			if len(body) == 0 {
@@ -56,7 +96,11 @@ func newStubServer(t *testing.T, wg *sync.WaitGroup) *stubServer {
 
 			// respond with 200 OK to indicate success
 			w.WriteHeader(http.StatusOK)
-			_, _ = fmt.Fprintln(w, `{"took": 1, "errors": false}`)
+			if s.BulkResponse != "" {
+				_, _ = fmt.Fprintln(w, s.BulkResponse)
+			} else {
+				_, _ = fmt.Fprintln(w, `{"took": 1, "errors": false}`)
+			}
 
 			if s.wg != nil {
 				s.wg.Done()
@@ -69,9 +113,39 @@ func newStubServer(t *testing.T, wg *sync.WaitGroup) *stubServer {
 		http.Error(w, "invalid request", http.StatusBadRequest)
 	}))
 
+	if tlsConfig != nil {
+		// handshake failures are expected by the tests
+		s.server.Config.ErrorLog = log.New(io.Discard, "", 0)
+		s.server.TLS = tlsConfig
+		s.server.StartTLS()
+	} else {
+		s.server.Start()
+	}
+
 	return s
 }
 
+// Compressed returns the number of bulk requests received with a gzip body.
+func (s *stubServer) Compressed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compressed
+}
+
+// LastBody returns the decoded body of the most recent bulk request.
+func (s *stubServer) LastBody() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastBody
+}
+
+// LastHeader returns the headers of the most recent bulk request.
+func (s *stubServer) LastHeader() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastHeader
+}
+
 func (s *stubServer) URL() string {
 	return s.server.URL
 }